@@ -0,0 +1,267 @@
+// Package bulk loads a large number of rows into a MySQL table with LOAD DATA
+// LOCAL INFILE, which is much faster than INSERT statements.  Rows are
+// streamed as TSV through a reader registered to the MySQL driver
+// (github.com/go-sql-driver/mysql), so they need not fit in memory.  The
+// server must enable the local_infile system variable.
+package bulk
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/imos/imosql"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Iterator returns rows one by one, and returns io.EOF after the last row.
+type Iterator func() (row interface{}, err error)
+
+// Warning is a warning reported by SHOW WARNINGS (e.g. a truncated value).
+type Warning struct {
+	Level   string `sql:"Level"`
+	Code    int    `sql:"Code"`
+	Message string `sql:"Message"`
+}
+
+// Result is the result of Load.
+type Result struct {
+	// RowsAffected is the number of rows loaded.
+	RowsAffected int64
+	Warnings     []Warning
+}
+
+var readerCount int64
+
+// Load loads rows into a table, and returns the number of loaded rows with
+// warnings.  rows must be a slice of row structs with sql tags (or pointers
+// to them), or an Iterator returning row structs of the same type.  Every
+// field is loaded, and nil pointers are loaded as NULL.
+//
+// Rows in a slice are validated before loading.  Rows from an Iterator are
+// validated while streaming, so an invalid row or an error of the Iterator
+// may leave the rows before it loaded.  Run Load in a transaction to load
+// all or nothing.
+func Load(con *imosql.Connection, table string, rows interface{}) (*Result, error) {
+	if _, ok := con.Dialect().(imosql.MySQLDialect); !ok {
+		return nil, fmt.Errorf("LOAD DATA is not supported by %s.", con.Dialect().Name())
+	}
+	next, err := newIterator(rows)
+	if err != nil {
+		return nil, err
+	}
+	first, err := next()
+	if err == io.EOF {
+		return &Result{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	rowType := structType(reflect.TypeOf(first))
+	if rowType == nil {
+		return nil, fmt.Errorf("row must be a struct but %T.", first)
+	}
+	columns := []string{}
+	for fieldIndex := 0; fieldIndex < rowType.NumField(); fieldIndex++ {
+		field := rowType.Field(fieldIndex)
+		column := imosql.ColumnName(field)
+		if column == "" {
+			return nil, fmt.Errorf(
+				"every field of a row struct must have a sql tag: %s", field.Name)
+		}
+		if !isSupportedType(field.Type) {
+			return nil, fmt.Errorf(
+				"unsupported type of %s: %s.", field.Name, field.Type.String())
+		}
+		columns = append(columns, con.Dialect().QuoteIdentifier(column))
+	}
+	if value := reflect.ValueOf(rows); value.Kind() == reflect.Slice {
+		for index := 0; index < value.Len(); index++ {
+			if _, err := rowValue(index, value.Index(index).Interface(), rowType); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Warnings are available only in the connection which ran LOAD DATA, so
+	// a session or a transaction is used as it is.  Otherwise, LOAD DATA
+	// runs in a new session.  LOAD DATA is never retried because the rows
+	// are streamed only once.
+	session := con.NoRetry()
+	if !con.InSession() && !con.InTransaction() {
+		if session, err = session.Session(); err != nil {
+			return nil, err
+		}
+		defer session.Close()
+	}
+
+	reader, writer := io.Pipe()
+	name := fmt.Sprintf("imosql_bulk_%d", atomic.AddInt64(&readerCount, 1))
+	mysql.RegisterReaderHandler(name, func() io.Reader { return reader })
+	defer mysql.DeregisterReaderHandler(name)
+	var writeErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		writeErr = writeRows(writer, con.Dialect(), rowType, first, next)
+		writer.CloseWithError(writeErr)
+	}()
+	result, err := session.Execute(fmt.Sprintf(
+		"LOAD DATA LOCAL INFILE 'Reader::%s' INTO TABLE %s "+
+			"CHARACTER SET utf8mb4 "+
+			"FIELDS TERMINATED BY '\\t' ESCAPED BY '\\\\' "+
+			"LINES TERMINATED BY '\\n' (%s)",
+		name, con.Dialect().QuoteIdentifier(table), strings.Join(columns, ", ")))
+	// Closing the reader stops writeRows if the server stops reading.
+	reader.Close()
+	<-done
+	if writeErr != nil && writeErr != io.ErrClosedPipe {
+		return nil, writeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	loadResult := &Result{Warnings: []Warning{}}
+	if loadResult.RowsAffected, err = result.RowsAffected(); err != nil {
+		return nil, err
+	}
+	if err := session.Rows(&loadResult.Warnings, "SHOW WARNINGS"); err != nil {
+		return nil, err
+	}
+	return loadResult, nil
+}
+
+// LoadOrDie runs Load.  If Load fails, this function panics.
+func LoadOrDie(con *imosql.Connection, table string, rows interface{}) *Result {
+	result, err := Load(con, table, rows)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+func structType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+func newIterator(rows interface{}) (Iterator, error) {
+	if iterator, ok := rows.(Iterator); ok {
+		return iterator, nil
+	}
+	if iterator, ok := rows.(func() (interface{}, error)); ok {
+		return iterator, nil
+	}
+	value := reflect.ValueOf(rows)
+	if value.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("rows must be a slice or an Iterator but %T.", rows)
+	}
+	index := 0
+	return func() (interface{}, error) {
+		if index >= value.Len() {
+			return nil, io.EOF
+		}
+		index++
+		return value.Index(index - 1).Interface(), nil
+	}, nil
+}
+
+// writeRows writes rows as TSV for LOAD DATA.
+func writeRows(w io.Writer, dialect imosql.Dialect, rowType reflect.Type, first interface{}, next Iterator) error {
+	buffer := bufio.NewWriterSize(w, 64*1024)
+	row := first
+	for rowIndex := 0; ; rowIndex++ {
+		value, err := rowValue(rowIndex, row, rowType)
+		if err != nil {
+			return err
+		}
+		for fieldIndex := 0; fieldIndex < value.NumField(); fieldIndex++ {
+			if fieldIndex > 0 {
+				buffer.WriteByte('\t')
+			}
+			field, err := formatField(value.Field(fieldIndex), dialect)
+			if err != nil {
+				return fmt.Errorf("row #%d: %s", rowIndex, err)
+			}
+			buffer.WriteString(field)
+		}
+		if err := buffer.WriteByte('\n'); err != nil {
+			return err
+		}
+		row, err = next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	return buffer.Flush()
+}
+
+// rowValue returns the struct of a row, which must be rowType.
+func rowValue(rowIndex int, row interface{}, rowType reflect.Type) (reflect.Value, error) {
+	value := reflect.ValueOf(row)
+	for value.Kind() == reflect.Ptr && !value.IsNil() {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct || value.Type() != rowType {
+		return reflect.Value{}, fmt.Errorf(
+			"row #%d must be %s but %T.", rowIndex, rowType.String(), row)
+	}
+	return value, nil
+}
+
+// isSupportedType returns true iff formatField can format a field of a type.
+func isSupportedType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+var fieldEscaper = strings.NewReplacer(
+	`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`, "\x00", `\0`)
+
+// formatField formats a field as a TSV field for LOAD DATA.  NULL is \N.
+func formatField(field reflect.Value, dialect imosql.Dialect) (string, error) {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return `\N`, nil
+		}
+		field = field.Elem()
+	}
+	if t, ok := field.Interface().(time.Time); ok {
+		return dialect.FormatTime(t), nil
+	}
+	switch field.Kind() {
+	case reflect.Bool:
+		if field.Bool() {
+			return "1", nil
+		}
+		return "0", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(field.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(field.Uint(), 10), nil
+	case reflect.String:
+		return fieldEscaper.Replace(field.String()), nil
+	}
+	return "", fmt.Errorf("unsupported type: %s.", field.Type().String())
+}
@@ -0,0 +1,164 @@
+package bulk
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/imos/imosql"
+	"github.com/imos/imosql/imosqltest/fakedb"
+	"io"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testRow struct {
+	Id      int64      `sql:"user_id"`
+	Name    string     `sql:"user_name"`
+	Admin   bool       `sql:"user_admin"`
+	Created *time.Time `sql:"user_created"`
+}
+
+func TestWriteRows(t *testing.T) {
+	created := time.Date(2000, 1, 2, 3, 4, 5, 0, time.UTC)
+	rows := []*testRow{
+		{1, "foo", true, &created},
+		{2, "a\tb\nc\\d\x00", false, nil},
+	}
+	next, err := newIterator(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := next()
+	output := &bytes.Buffer{}
+	if err := writeRows(output, imosql.MySQLDialect{},
+		reflect.TypeOf(testRow{}), first, next); err != nil {
+		t.Fatalf("failed to write rows: %s", err)
+	}
+	expected := "1\tfoo\t1\t2000-01-02 03:04:05\n" +
+		"2\ta\\tb\\nc\\\\d\\0\t0\t\\N\n"
+	if output.String() != expected {
+		t.Errorf("expected: %q, actual: %q.", expected, output.String())
+	}
+}
+
+func TestWriteRows_Invalid(t *testing.T) {
+	rows := []interface{}{testRow{Id: 1}, struct{ Id int }{2}}
+	next, _ := newIterator(rows)
+	first, _ := next()
+	err := writeRows(&bytes.Buffer{}, imosql.MySQLDialect{},
+		reflect.TypeOf(testRow{}), first, next)
+	if err == nil || !strings.Contains(err.Error(), "row #1") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func loadQuery(readerIndex int) string {
+	return fmt.Sprintf(
+		"LOAD DATA LOCAL INFILE 'Reader::imosql_bulk_%d' INTO TABLE `users` "+
+			"CHARACTER SET utf8mb4 FIELDS TERMINATED BY '\\t' ESCAPED BY '\\\\' "+
+			"LINES TERMINATED BY '\\n' "+
+			"(`user_id`, `user_name`, `user_admin`, `user_created`)", readerIndex)
+}
+
+func TestLoad(t *testing.T) {
+	con, fake := fakedb.Open(t)
+	fake.Expect(loadQuery(1)).ReturnsResult(0, 2)
+	fake.Expect("SHOW WARNINGS").Returns(
+		[]string{"Level", "Code", "Message"},
+		[]interface{}{"Warning", 1265, "Data truncated for column 'user_name' at row 2"})
+	count := 0
+	iterator := Iterator(func() (interface{}, error) {
+		if count == 2 {
+			return nil, io.EOF
+		}
+		count++
+		return testRow{Id: int64(count)}, nil
+	})
+	result, err := Load(con, "users", iterator)
+	if err != nil {
+		t.Fatalf("failed to load: %s", err)
+	}
+	if result.RowsAffected != 2 || len(result.Warnings) != 1 ||
+		result.Warnings[0].Code != 1265 {
+		t.Errorf("unexpected result: %#v.", result)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+
+	fake.Expect(loadQuery(2)).ReturnsError(errors.New("local_infile is disabled"))
+	if _, err := Load(con, "users", []testRow{{}}); err == nil ||
+		!strings.Contains(err.Error(), "local_infile is disabled") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if result, err := Load(con, "users", []testRow{}); err != nil || result.RowsAffected != 0 {
+		t.Errorf("unexpected result for no rows: %#v, %v.", result, err)
+	}
+}
+
+func TestLoad_InvalidRows(t *testing.T) {
+	con, fake := fakedb.Open(t)
+	// Rows in a slice are validated before LOAD DATA runs.
+	rows := []interface{}{testRow{Id: 1}, struct{ Id int }{2}}
+	if _, err := Load(con, "users", rows); err == nil ||
+		!strings.Contains(err.Error(), "row #1") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	type floatRow struct {
+		Score float64 `sql:"user_score"`
+	}
+	if _, err := Load(con, "users", []floatRow{{1}}); err == nil ||
+		!strings.Contains(err.Error(), "unsupported type") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoad_InTransaction(t *testing.T) {
+	con, fake := fakedb.Open(t)
+	fake.Expect(loadQuery(int(atomic.LoadInt64(&readerCount))+1)).ReturnsResult(0, 1)
+	fake.Expect("SHOW WARNINGS").Returns([]string{"Level", "Code", "Message"})
+	err := con.Transaction(func(tx *imosql.Connection) error {
+		result, err := Load(tx, "users", []testRow{{Id: 1}})
+		if err == nil && result.RowsAffected != 1 {
+			t.Errorf("unexpected result: %#v.", result)
+		}
+		return err
+	})
+	if err != nil {
+		t.Errorf("failed to load in a transaction: %s", err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+// mysqlError has the same fields as MySQLError of
+// github.com/go-sql-driver/mysql.
+type mysqlError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *mysqlError) Error() string {
+	return e.Message
+}
+
+func TestLoad_NoRetry(t *testing.T) {
+	con, fake := fakedb.Open(t)
+	con.SetRetryPolicy(&imosql.RetryPolicy{MaxAttempts: 3})
+	fake.Expect(loadQuery(int(atomic.LoadInt64(&readerCount)) + 1)).
+		ReturnsError(&mysqlError{1213, "Deadlock found"})
+	// A retried LOAD DATA would read the drained stream and load no rows.
+	if _, err := Load(con, "users", []testRow{{Id: 1}}); !imosql.IsDeadlock(err) {
+		t.Errorf("the deadlock should be returned: %v", err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,88 @@
+package imosql
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock provides the current time.  Connection.Now uses the Clock set by
+// Connection.SetClock, so tests can replace the server's clock with
+// SystemClock or ManualClock without any SQL server.
+type Clock interface {
+	// Now returns the current time.
+	Now() (time.Time, error)
+}
+
+// SystemClock is a Clock returning the local time in UTC.
+type SystemClock struct{}
+
+func (SystemClock) Now() (time.Time, error) {
+	return time.Now().UTC(), nil
+}
+
+// ServerClock is a Clock returning the server's time, which is estimated by
+// the local clock and the gap synchronized periodically.  It is the default
+// Clock of a Connection.
+type ServerClock struct {
+	Connection *Connection
+}
+
+func (sc ServerClock) Now() (time.Time, error) {
+	skew, err := sc.Connection.ClockSkew()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(-skew.Offset).UTC(), nil
+}
+
+// ManualClock is a Clock which never advances unless ManualClock.Set or
+// ManualClock.Advance is called.  It is useful for deterministic tests.
+type ManualClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+// NewManualClock returns a ManualClock frozen at now.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now.UTC()}
+}
+
+func (mc *ManualClock) Now() (time.Time, error) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	return mc.now, nil
+}
+
+// Set sets the current time of the clock.
+func (mc *ManualClock) Set(now time.Time) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	mc.now = now.UTC()
+}
+
+// Advance advances the clock by duration.
+func (mc *ManualClock) Advance(duration time.Duration) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	mc.now = mc.now.Add(duration)
+}
+
+// SetClock sets a Clock used by Connection.Now.  If clock is nil, the
+// Connection uses ServerClock.
+func (c *Connection) SetClock(clock Clock) {
+	c = c.root()
+	c.clock.mutex.Lock()
+	defer c.clock.mutex.Unlock()
+	c.clock.source = clock
+}
+
+// Clock returns the Clock used by Connection.Now.
+func (c *Connection) Clock() Clock {
+	c = c.root()
+	c.clock.mutex.Lock()
+	defer c.clock.mutex.Unlock()
+	if c.clock.source == nil {
+		return ServerClock{Connection: c}
+	}
+	return c.clock.source
+}
@@ -0,0 +1,40 @@
+package imosql_test
+
+import (
+	imosql "."
+	"testing"
+	"time"
+)
+
+func TestManualClock(t *testing.T) {
+	con := &imosql.Connection{}
+	startTime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	clock := imosql.NewManualClock(startTime)
+	con.SetClock(clock)
+	if actual := con.CurrentTime(); !actual.Equal(startTime) {
+		t.Errorf("expected: %v, actual: %v.", startTime, actual)
+	}
+	clock.Advance(90 * time.Second)
+	expected := startTime.Add(90 * time.Second)
+	if actual := con.CurrentTime(); !actual.Equal(expected) {
+		t.Errorf("expected: %v, actual: %v.", expected, actual)
+	}
+	clock.Set(startTime)
+	if actual := con.CurrentTime(); !actual.Equal(startTime) {
+		t.Errorf("expected: %v, actual: %v.", startTime, actual)
+	}
+}
+
+func TestSystemClock(t *testing.T) {
+	con := &imosql.Connection{}
+	con.SetClock(imosql.SystemClock{})
+	before := time.Now()
+	actual := con.CurrentTime()
+	if actual.Before(before) || actual.After(time.Now()) {
+		t.Errorf("unexpected time: %v.", actual)
+	}
+	con.SetClock(nil)
+	if _, ok := con.Clock().(imosql.ServerClock); !ok {
+		t.Errorf("the default clock must be ServerClock: %#v.", con.Clock())
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/imos/imosql"
+	"go/format"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Generator generates Go source code with row structs for tables.
+type Generator struct {
+	// Package is the package name of the generated file.
+	Package string
+	// CRUD enables helper functions to get, insert, update and delete a row
+	// by its primary key.
+	CRUD bool
+}
+
+// goName converts a SQL name into an exported Go identifier (e.g. user_id to
+// UserId).
+func goName(name string) string {
+	result := ""
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		runes := []rune(strings.ToLower(part))
+		runes[0] = unicode.ToUpper(runes[0])
+		result += string(runes)
+	}
+	if result == "" || !unicode.IsLetter([]rune(result)[0]) {
+		result = "X" + result
+	}
+	return result
+}
+
+// columnTypePattern matches a column type as a base name, an optional size
+// and modifiers (e.g. "bigint(20) unsigned zerofill" or "bigint unsigned",
+// which MySQL 8.0.19 or later prints without display widths).
+var columnTypePattern = regexp.MustCompile(`^([a-z0-9_]+)\s*(\(([^)]*)\))?(.*)$`)
+
+// goType returns the Go type of a column, which is one of the types parseField
+// supports.  Types without a corresponding Go type (e.g. DECIMAL and BLOB) are
+// read as strings.
+func goType(column imosql.ColumnInfo) string {
+	columnType := strings.ToLower(strings.TrimSpace(column.Type))
+	match := columnTypePattern.FindStringSubmatch(columnType)
+	name, size, unsigned := "", "", ""
+	if match != nil {
+		name, size = match[1], match[3]
+		for _, modifier := range strings.Fields(match[4]) {
+			// ZEROFILL implies UNSIGNED in MySQL.
+			if modifier == "unsigned" || modifier == "zerofill" {
+				unsigned = "u"
+			}
+		}
+	}
+	result := "string"
+	switch name {
+	case "bool", "boolean":
+		result = "bool"
+	case "tinyint":
+		if size == "1" && unsigned == "" {
+			result = "bool"
+		} else {
+			result = unsigned + "int8"
+		}
+	case "smallint", "int2", "smallserial":
+		result = unsigned + "int16"
+	case "mediumint", "int", "integer", "int4", "serial":
+		result = unsigned + "int"
+	case "bigint", "int8", "bigserial":
+		result = unsigned + "int64"
+	case "date", "datetime", "timestamp", "timestamptz":
+		result = "time.Time"
+	}
+	if column.Nullable {
+		result = "*" + result
+	}
+	return result
+}
+
+// Generate returns formatted Go source code of row structs for tables.
+func (g *Generator) Generate(con *imosql.Connection, tables []string) ([]byte, error) {
+	body := &bytes.Buffer{}
+	imports := map[string]bool{}
+	for _, table := range tables {
+		columns, err := con.Columns(table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read columns of %s: %s", table, err)
+		}
+		g.writeStruct(body, imports, con.Dialect(), table, columns)
+	}
+	output := &bytes.Buffer{}
+	fmt.Fprintf(output, "// Code generated by imosql-gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(output, "package %s\n\n", g.Package)
+	if len(imports) > 0 {
+		fmt.Fprintf(output, "import (\n")
+		for _, path := range []string{
+			"database/sql", "github.com/imos/imosql", "time"} {
+			if imports[path] {
+				fmt.Fprintf(output, "%q\n", path)
+			}
+		}
+		fmt.Fprintf(output, ")\n\n")
+	}
+	output.Write(body.Bytes())
+	source, err := format.Source(output.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %s", err)
+	}
+	return source, nil
+}
+
+// writeStruct writes a row struct of a table and its CRUD helpers, whose
+// queries quote identifiers in the syntax of dialect.
+func (g *Generator) writeStruct(w *bytes.Buffer, imports map[string]bool, dialect imosql.Dialect, table string, columns []imosql.ColumnInfo) {
+	structName := goName(table) + "Row"
+	primaryKey := []imosql.ColumnInfo{}
+	fmt.Fprintf(w, "// %s is a row of the %s table.\n", structName, table)
+	fmt.Fprintf(w, "type %s struct {\n", structName)
+	for _, column := range columns {
+		fieldType := goType(column)
+		if strings.HasSuffix(fieldType, "time.Time") {
+			imports["time"] = true
+		}
+		tag := column.Name
+		if column.Key == "PRI" {
+			tag += ",pk"
+			primaryKey = append(primaryKey, column)
+		}
+		fmt.Fprintf(w, "%s %s `sql:%q`\n", goName(column.Name), fieldType, tag)
+	}
+	fmt.Fprintf(w, "}\n\n")
+	if !g.CRUD {
+		return
+	}
+	if len(primaryKey) == 0 {
+		fmt.Fprintf(w, "// %s has no CRUD helpers because %s has no primary key.\n\n",
+			structName, table)
+		return
+	}
+	imports["database/sql"] = true
+	imports["github.com/imos/imosql"] = true
+
+	quotedTable := dialect.QuoteIdentifier(table)
+	names, nonKeyNames := []string{}, []string{}
+	for _, column := range columns {
+		names = append(names, dialect.QuoteIdentifier(column.Name))
+		if column.Key != "PRI" {
+			nonKeyNames = append(nonKeyNames, column.Name)
+		}
+	}
+	params, args, conditions := []string{}, []string{}, []string{}
+	for _, column := range primaryKey {
+		param := goName(column.Name)
+		param = strings.ToLower(param[:1]) + param[1:]
+		params = append(params, param+" "+strings.TrimPrefix(goType(column), "*"))
+		args = append(args, param)
+		conditions = append(conditions, dialect.QuoteIdentifier(column.Name)+" = ?")
+	}
+	where := strings.Join(conditions, " AND ")
+
+	fmt.Fprintf(w, "// Get%s returns the row of %s with a primary key, or nil if there\n", structName, table)
+	fmt.Fprintf(w, "// is no such row.\n")
+	fmt.Fprintf(w, "func Get%s(con *imosql.Connection, %s) (*%s, error) {\n",
+		structName, strings.Join(params, ", "), structName)
+	fmt.Fprintf(w, "row := &%s{}\n", structName)
+	fmt.Fprintf(w, "found, err := con.Row(row, %q, %s)\n",
+		fmt.Sprintf("SELECT %s FROM %s WHERE %s",
+			strings.Join(names, ", "), quotedTable, where),
+		strings.Join(args, ", "))
+	fmt.Fprintf(w, "if err != nil || !found {\nreturn nil, err\n}\nreturn row, nil\n}\n\n")
+
+	fmt.Fprintf(w, "// Insert%s inserts a row into %s.\n", structName, table)
+	fmt.Fprintf(w, "func Insert%s(con *imosql.Connection, row *%s) (sql.Result, error) {\n",
+		structName, structName)
+	fmt.Fprintf(w, "return con.Insert(%q, row)\n}\n\n", table)
+
+	if len(nonKeyNames) > 0 {
+		assignments, values := []string{}, []string{}
+		for _, column := range columns {
+			if column.Key != "PRI" {
+				assignments = append(assignments, dialect.QuoteIdentifier(column.Name)+" = ?")
+				values = append(values, "row."+goName(column.Name))
+			}
+		}
+		for _, column := range primaryKey {
+			values = append(values, "row."+goName(column.Name))
+		}
+		fmt.Fprintf(w, "// Update%s updates the row of %s with the primary key of row.\n",
+			structName, table)
+		fmt.Fprintf(w, "func Update%s(con *imosql.Connection, row *%s) error {\n",
+			structName, structName)
+		fmt.Fprintf(w, "return con.Change(%q, %s)\n}\n\n",
+			fmt.Sprintf("UPDATE %s SET %s WHERE %s",
+				quotedTable, strings.Join(assignments, ", "), where),
+			strings.Join(values, ", "))
+	}
+
+	fmt.Fprintf(w, "// Delete%s deletes the row of %s with a primary key.\n", structName, table)
+	fmt.Fprintf(w, "func Delete%s(con *imosql.Connection, %s) error {\n",
+		structName, strings.Join(params, ", "))
+	fmt.Fprintf(w, "return con.Change(%q, %s)\n}\n\n",
+		fmt.Sprintf("DELETE FROM %s WHERE %s", quotedTable, where),
+		strings.Join(args, ", "))
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"github.com/imos/imosql"
+	"github.com/imos/imosql/imosqltest/fakedb"
+	"strings"
+	"testing"
+)
+
+var infoColumns = []string{"column_name", "column_type", "is_nullable",
+	"column_default", "column_key", "ordinal_position"}
+
+func TestGoType(t *testing.T) {
+	testCases := []struct {
+		columnType string
+		nullable   bool
+		expected   string
+	}{
+		{"tinyint(1)", false, "bool"},
+		{"tinyint(3) unsigned", false, "uint8"},
+		{"int(11)", true, "*int"},
+		{"bigint(20) unsigned", false, "uint64"},
+		{"bigint unsigned", false, "uint64"},
+		{"int unsigned", true, "*uint"},
+		{"int(10) unsigned zerofill", false, "uint"},
+		{"smallint zerofill", false, "uint16"},
+		{"tinyint unsigned", false, "uint8"},
+		{"varchar(64)", false, "string"},
+		{"decimal(10,2)", false, "string"},
+		{"datetime", true, "*time.Time"},
+		{"timestamp without time zone", false, "time.Time"},
+		{"timestamp with time zone", false, "time.Time"},
+		{"double precision", false, "string"},
+		{"INTEGER", false, "int"},
+	}
+	for _, testCase := range testCases {
+		actual := goType(imosql.ColumnInfo{
+			Type: testCase.columnType, Nullable: testCase.nullable})
+		if actual != testCase.expected {
+			t.Errorf("%s: expected: %s, actual: %s.",
+				testCase.columnType, testCase.expected, actual)
+		}
+	}
+}
+
+func TestGoName(t *testing.T) {
+	for input, expected := range map[string]string{
+		"user_id": "UserId", "USER_NAME": "UserName", "2fa": "X2fa"} {
+		if actual := goName(input); actual != expected {
+			t.Errorf("%s: expected: %s, actual: %s.", input, expected, actual)
+		}
+	}
+}
+
+const expectedSource = "// Code generated by imosql-gen. DO NOT EDIT.\n" + `
+package models
+
+import (
+	"database/sql"
+	"github.com/imos/imosql"
+	"time"
+)
+
+// UsersRow is a row of the users table.
+type UsersRow struct {
+	UserId      int64      ` + "`sql:\"user_id,pk\"`" + `
+	UserName    string     ` + "`sql:\"user_name\"`" + `
+	UserCreated *time.Time ` + "`sql:\"user_created\"`" + `
+}
+
+// GetUsersRow returns the row of users with a primary key, or nil if there
+// is no such row.
+func GetUsersRow(con *imosql.Connection, userId int64) (*UsersRow, error) {
+	row := &UsersRow{}
+	found, err := con.Row(row, "SELECT ` + "`user_id`, `user_name`, `user_created` FROM `users` WHERE `user_id` = ?" + `", userId)
+	if err != nil || !found {
+		return nil, err
+	}
+	return row, nil
+}
+
+// InsertUsersRow inserts a row into users.
+func InsertUsersRow(con *imosql.Connection, row *UsersRow) (sql.Result, error) {
+	return con.Insert("users", row)
+}
+
+// UpdateUsersRow updates the row of users with the primary key of row.
+func UpdateUsersRow(con *imosql.Connection, row *UsersRow) error {
+	return con.Change("UPDATE ` + "`users` SET `user_name` = ?, `user_created` = ? WHERE `user_id` = ?" + `", row.UserName, row.UserCreated, row.UserId)
+}
+
+// DeleteUsersRow deletes the row of users with a primary key.
+func DeleteUsersRow(con *imosql.Connection, userId int64) error {
+	return con.Change("DELETE FROM ` + "`users` WHERE `user_id` = ?" + `", userId)
+}
+
+// LogsRow is a row of the logs table.
+type LogsRow struct {
+	LogBody string ` + "`sql:\"log_body\"`" + `
+}
+
+// LogsRow has no CRUD helpers because logs has no primary key.
+`
+
+func TestGenerator_Generate(t *testing.T) {
+	con, fake := fakedb.Open(t)
+	query := imosql.MySQLDialect{}.ColumnsQuery()
+	fake.Expect(query, "users").Returns(
+		infoColumns,
+		[]interface{}{"user_id", "bigint(20)", 0, nil, "PRI", 1},
+		[]interface{}{"user_name", "varchar(64)", 0, nil, "UNI", 2},
+		[]interface{}{"user_created", "datetime", 1, nil, "", 3})
+	fake.Expect(query, "logs").Returns(
+		infoColumns, []interface{}{"log_body", "text", 0, nil, "", 1})
+	generator := &Generator{Package: "models", CRUD: true}
+	source, err := generator.Generate(con, []string{"users", "logs"})
+	if err != nil {
+		t.Fatalf("failed to generate: %s", err)
+	}
+	if string(source) != expectedSource {
+		t.Errorf("unexpected source:\n%s", source)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIsCompatibleType(t *testing.T) {
+	testCases := []struct {
+		fieldType  string
+		columnType string
+		expected   bool
+	}{
+		{"int64", "decimal(20,0)", true},
+		{"int64", "decimal(10,2)", false},
+		{"int64", "point", false},
+		{"time.Time", "date", true},
+		{"uint", "int(10) unsigned", true},
+		{"bool", "tinyint(1)", true},
+		{"string", "blob", true},
+		{"time.Time", "timestamp with time zone", true},
+		{"time.Time", "varchar(32)", false},
+		{"int", "varchar(32)", false},
+		{"float64", "double", false},
+		{"sql.NullString", "varchar(32)", false},
+	}
+	for _, testCase := range testCases {
+		actual := isCompatibleType(
+			testCase.fieldType, imosql.ColumnInfo{Type: testCase.columnType})
+		if actual != testCase.expected {
+			t.Errorf("%s for %s: expected: %v, actual: %v.", testCase.fieldType,
+				testCase.columnType, testCase.expected, actual)
+		}
+	}
+}
+
+func TestGenerator_Verify(t *testing.T) {
+	con, fake := fakedb.Open(t)
+	query := imosql.MySQLDialect{}.ColumnsQuery()
+	fake.Expect(query, "users").Returns(
+		infoColumns,
+		[]interface{}{"user_id", "int(10) unsigned", 0, nil, "PRI", 1},
+		[]interface{}{"user_name", "varchar(64)", 1, nil, "", 2},
+		[]interface{}{"user_created", "varchar(32)", 1, nil, "", 3},
+		[]interface{}{"user_admin", "tinyint(1)", 0, nil, "", 4})
+	fake.Expect(query, "logs").Returns(
+		infoColumns, []interface{}{"log_body", "text", 0, nil, "", 1})
+	fake.Expect(query, "posts").Returns(
+		infoColumns, []interface{}{"post_id", "bigint(20)", 0, nil, "PRI", 1})
+	generator := &Generator{Package: "models"}
+	problems, err := generator.Verify(
+		con, []string{"users", "logs", "posts"}, []byte(expectedSource))
+	if err != nil {
+		t.Fatalf("failed to verify: %s", err)
+	}
+	expected := []string{
+		"UsersRow.UserName: column user_name is nullable but the field is not a pointer",
+		"UsersRow.UserCreated: column user_created is varchar(32) but the field is *time.Time",
+		"UsersRow: column user_admin has no field",
+		"PostsRow: missing struct for table posts",
+	}
+	if strings.Join(problems, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected problems:\n%s", strings.Join(problems, "\n"))
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
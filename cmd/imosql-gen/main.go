@@ -0,0 +1,86 @@
+// Command imosql-gen generates Go row structs with sql tags for existing
+// tables.  It connects to a database with the -driver_name and
+// -data_source_name flags of imosql:
+//
+//	imosql-gen -data_source_name='user@/db' -package=models -crud \
+//	    -output=models/rows.go users posts
+//
+// If no tables are given, structs are generated for all tables.  A nullable
+// column becomes a pointer field, and a column of a type which imosql cannot
+// parse into a Go type (e.g. DECIMAL) becomes a string field.
+//
+// With -verify, imosql-gen compares the row structs in the -output file with
+// the live tables instead of writing it, and exits with a non-zero status if
+// they differ (e.g. to catch schema drift in CI):
+//
+//	imosql-gen -data_source_name='user@/db' -verify -output=models/rows.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/imos/imosql"
+	"io/ioutil"
+	"os"
+)
+
+var packageName = flag.String("package", "main", "Package name of the generated file.")
+var output = flag.String("output", "", "Output file. Standard output if empty.")
+var crud = flag.Bool("crud", false, "Generates CRUD helpers for tables with primary keys.")
+var verify = flag.Bool("verify", false, "Verifies the output file against the tables.")
+
+func main() {
+	flag.Parse()
+	if err := run(flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "imosql-gen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(tables []string) error {
+	con, err := imosql.Open("mysql", "")
+	if err != nil {
+		return err
+	}
+	if len(tables) == 0 {
+		tables, err = con.Tables()
+		if err != nil {
+			return err
+		}
+	}
+	generator := &Generator{Package: *packageName, CRUD: *crud}
+	if *verify {
+		return runVerify(con, generator, tables)
+	}
+	source, err := generator.Generate(con, tables)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(source)
+		return err
+	}
+	return ioutil.WriteFile(*output, source, 0644)
+}
+
+func runVerify(con *imosql.Connection, generator *Generator, tables []string) error {
+	if *output == "" {
+		return fmt.Errorf("-verify requires -output.")
+	}
+	source, err := ioutil.ReadFile(*output)
+	if err != nil {
+		return err
+	}
+	problems, err := generator.Verify(con, tables, source)
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found in %s.", len(problems), *output)
+	}
+	return nil
+}
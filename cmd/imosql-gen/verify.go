@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"github.com/imos/imosql"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sourceField is a field of a row struct in Go source code.
+type sourceField struct {
+	Name   string
+	Type   string
+	Column string
+}
+
+// parseRowStructs returns the fields with sql tags of the structs in Go
+// source code by the names of the structs.
+func parseRowStructs(source []byte) (map[string][]sourceField, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", source, 0)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string][]sourceField{}
+	ast.Inspect(file, func(node ast.Node) bool {
+		typeSpec, ok := node.(*ast.TypeSpec)
+		if !ok {
+			return true
+		}
+		structType, ok := typeSpec.Type.(*ast.StructType)
+		if !ok {
+			return false
+		}
+		fields := []sourceField{}
+		for _, field := range structType.Fields.List {
+			if field.Tag == nil || len(field.Names) == 0 {
+				continue
+			}
+			tag, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				continue
+			}
+			column := strings.Split(reflect.StructTag(tag).Get("sql"), ",")[0]
+			if column == "" {
+				continue
+			}
+			for _, name := range field.Names {
+				fields = append(fields, sourceField{
+					name.Name, types.ExprString(field.Type), column})
+			}
+		}
+		result[typeSpec.Name.Name] = fields
+		return false
+	})
+	return result, nil
+}
+
+// sourceTypes maps the names of field types in Go source code to their
+// types, which are checked by imosql.IsCompatibleColumnType.
+var sourceTypes = map[string]reflect.Type{
+	"bool": reflect.TypeOf(false), "string": reflect.TypeOf(""),
+	"int": reflect.TypeOf(int(0)), "int8": reflect.TypeOf(int8(0)),
+	"int16": reflect.TypeOf(int16(0)), "int32": reflect.TypeOf(int32(0)),
+	"int64": reflect.TypeOf(int64(0)), "uint": reflect.TypeOf(uint(0)),
+	"uint8": reflect.TypeOf(uint8(0)), "uint16": reflect.TypeOf(uint16(0)),
+	"uint32": reflect.TypeOf(uint32(0)), "uint64": reflect.TypeOf(uint64(0)),
+	"time.Time": reflect.TypeOf(time.Time{}),
+}
+
+// isCompatibleType returns true iff a field of a type can hold every value of
+// a column, which is decided by imosql.IsCompatibleColumnType in the same way
+// as imosql.Connection.VerifySchema.  A field of a type unknown to
+// sourceTypes must have the type generated for the column.  The field type
+// must not be a pointer.
+func isCompatibleType(fieldType string, column imosql.ColumnInfo) bool {
+	if sourceType, ok := sourceTypes[fieldType]; ok {
+		return imosql.IsCompatibleColumnType(sourceType, column.Type)
+	}
+	return fieldType == strings.TrimPrefix(goType(column), "*")
+}
+
+// Verify compares row structs in Go source code, which are typically
+// generated by Generate before, with live tables, and returns the problems
+// found.  Fields are matched with columns by their sql tags, so renamed fields
+// and added options are allowed.
+func (g *Generator) Verify(con *imosql.Connection, tables []string, source []byte) ([]string, error) {
+	structs, err := parseRowStructs(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the source: %s", err)
+	}
+	problems := []string{}
+	for _, table := range tables {
+		columns, err := con.Columns(table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read columns of %s: %s", table, err)
+		}
+		structName := goName(table) + "Row"
+		fields, ok := structs[structName]
+		if !ok {
+			problems = append(problems,
+				fmt.Sprintf("%s: missing struct for table %s", structName, table))
+			continue
+		}
+		columnByName := map[string]imosql.ColumnInfo{}
+		for _, column := range columns {
+			columnByName[column.Name] = column
+		}
+		hasField := map[string]bool{}
+		for _, field := range fields {
+			hasField[field.Column] = true
+			name := structName + "." + field.Name
+			column, ok := columnByName[field.Column]
+			if !ok {
+				problems = append(problems,
+					fmt.Sprintf("%s: missing column %s", name, field.Column))
+				continue
+			}
+			expected := goType(column)
+			if strings.HasPrefix(expected, "*") && !strings.HasPrefix(field.Type, "*") {
+				problems = append(problems, fmt.Sprintf(
+					"%s: column %s is nullable but the field is not a pointer",
+					name, field.Column))
+			}
+			if !isCompatibleType(strings.TrimPrefix(field.Type, "*"), column) {
+				problems = append(problems, fmt.Sprintf(
+					"%s: column %s is %s but the field is %s",
+					name, field.Column, column.Type, field.Type))
+			}
+		}
+		for _, column := range columns {
+			if !hasField[column.Name] {
+				problems = append(problems, fmt.Sprintf(
+					"%s: column %s has no field", structName, column.Name))
+			}
+		}
+	}
+	return problems, nil
+}
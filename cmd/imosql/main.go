@@ -0,0 +1,143 @@
+// Command imosql is an interactive SQL shell.  It connects to a database with
+// the -driver_name and -data_source_name flags of imosql, and runs statements
+// read from the terminal or standard input:
+//
+//	imosql -data_source_name='user@/db'
+//	imosql -data_source_name='user@/db' < script.sql
+//
+// Results of queries are printed as aligned tables.  Statements end with a
+// semicolon and may span multiple lines.  Run \help in the shell for its
+// commands.
+//
+// The export subcommand writes the rows of a query in CSV, TSV, JSON Lines or
+// Markdown (see the export package for details):
+//
+//	imosql -data_source_name='user@/db' export -format=csv \
+//	    -output=users.csv 'SELECT * FROM users'
+//
+// The import subcommand inserts rows in CSV, TSV or JSON Lines into a table
+// (see the importer package for details):
+//
+//	imosql -data_source_name='user@/db' import -format=csv -table=users \
+//	    users.csv
+package main
+
+import (
+	"flag"
+	"fmt"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/imos/imosql"
+	"github.com/imos/imosql/export"
+	"github.com/imos/imosql/importer"
+	"os"
+	"path/filepath"
+)
+
+var historyFile = flag.String(
+	"history", filepath.Join(os.Getenv("HOME"), ".imosql_history"),
+	"File to save history of statements. History is not saved if empty.")
+var timing = flag.Bool("timing", true, "Prints the time taken by every statement.")
+
+func main() {
+	flag.Parse()
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "imosql: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	con, err := imosql.Open("mysql", "")
+	if err != nil {
+		return err
+	}
+	if flag.Arg(0) == "export" {
+		return runExport(con, flag.Args()[1:])
+	} else if flag.Arg(0) == "import" {
+		return runImport(con, flag.Args()[1:])
+	} else if flag.NArg() > 0 {
+		return fmt.Errorf("unknown subcommand: %s", flag.Arg(0))
+	}
+	shell := NewShell(con, os.Stdout)
+	shell.Timing = *timing
+	interactive := false
+	if stat, err := os.Stdin.Stat(); err == nil {
+		interactive = stat.Mode()&os.ModeCharDevice != 0
+	}
+	if interactive {
+		shell.HistoryFile = *historyFile
+		if err := shell.LoadHistory(); err != nil {
+			return err
+		}
+	}
+	return shell.Run(os.Stdin, interactive)
+}
+
+func runExport(con *imosql.Connection, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	formatName := flags.String(
+		"format", "csv", "Output format: csv, tsv, jsonl or markdown.")
+	output := flags.String("output", "", "Output file. Standard output if empty.")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("export requires exactly one query.")
+	}
+	format, err := export.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = export.Export(con, os.Stdout, format, flags.Arg(0))
+		return err
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	_, err = export.Export(con, file, format, flags.Arg(0))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func runImport(con *imosql.Connection, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	formatName := flags.String("format", "csv", "Input format: csv, tsv or jsonl.")
+	table := flags.String("table", "", "Table to insert rows into.")
+	batchSize := flags.Int(
+		"batch_size", importer.DefaultBatchSize, "# of rows inserted by a statement.")
+	dryRun := flags.Bool("dry_run", false, "Reads rows without inserting them.")
+	flags.Parse(args)
+	if *table == "" || flags.NArg() > 1 {
+		return fmt.Errorf("import requires -table and at most one input file.")
+	}
+	format, err := export.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	input := os.Stdin
+	if flags.NArg() == 1 {
+		if input, err = os.Open(flags.Arg(0)); err != nil {
+			return err
+		}
+		defer input.Close()
+	}
+	rowImporter := importer.New(*table)
+	rowImporter.BatchSize = *batchSize
+	rowImporter.DryRun = *dryRun
+	rowImporter.Progress = func(numRows int) {
+		fmt.Fprintf(os.Stderr, "\r%d rows", numRows)
+	}
+	numRows, err := rowImporter.Import(con, input, format)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Fprintf(os.Stderr, "%d rows are valid (dry run).\n", numRows)
+	} else {
+		fmt.Fprintf(os.Stderr, "%d rows are imported into %s.\n", numRows, *table)
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"github.com/imos/imosql"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxHistory is the maximum number of statements loaded from a history file.
+const maxHistory = 1000
+
+// Shell runs SQL statements read from an input and prints their results.
+type Shell struct {
+	con *imosql.Connection
+	// session is the Connection which Run runs statements on.
+	session *imosql.Connection
+	out     io.Writer
+	// Timing enables printing the time taken by every statement.
+	Timing bool
+	// HistoryFile is a file which statements are appended to.  History is not
+	// saved if it is empty.
+	HistoryFile string
+	history     []string
+	now         func() time.Time
+}
+
+// NewShell creates a Shell printing results to out.
+func NewShell(con *imosql.Connection, out io.Writer) *Shell {
+	return &Shell{con: con, out: out, Timing: true, now: time.Now}
+}
+
+// LoadHistory loads statements run before from HistoryFile.
+func (s *Shell) LoadHistory() error {
+	if s.HistoryFile == "" {
+		return nil
+	}
+	input, err := ioutil.ReadFile(s.HistoryFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(input), "\n") {
+		if line != "" {
+			s.history = append(s.history, line)
+		}
+	}
+	if len(s.history) > maxHistory {
+		s.history = s.history[len(s.history)-maxHistory:]
+	}
+	return nil
+}
+
+func (s *Shell) addHistory(statement string) {
+	statement = strings.Join(strings.Fields(statement), " ")
+	s.history = append(s.history, statement)
+	if s.HistoryFile == "" {
+		return
+	}
+	file, err := os.OpenFile(
+		s.HistoryFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		fmt.Fprintf(s.out, "WARNING: failed to save history: %s\n", err)
+		return
+	}
+	defer file.Close()
+	fmt.Fprintln(file, statement)
+}
+
+// Run reads statements from in until EOF or \q.  A statement may span
+// multiple lines and ends with a semicolon at the end of a line, which is
+// outside string literals and comments.  Lines starting with a backslash are
+// shell commands (see \help).  If interactive is true, Run shows prompts and
+// continues after errors; otherwise Run stops at the first error and returns
+// it.  Statements run on a single session of the Connection, so that session
+// states (e.g. USE and SET) are kept among them.
+func (s *Shell) Run(in io.Reader, interactive bool) error {
+	s.session = s.con
+	if !s.con.InSession() && !s.con.InTransaction() {
+		session, err := s.con.Session()
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+		s.session = session
+	}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	buffer := ""
+	for {
+		if interactive {
+			if buffer == "" {
+				fmt.Fprint(s.out, "imosql> ")
+			} else {
+				fmt.Fprint(s.out, "     -> ")
+			}
+		}
+		if !scanner.Scan() {
+			break
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if buffer == "" {
+			if line == "" {
+				continue
+			}
+			if line == `\q` || line == "quit" || line == "exit" {
+				return nil
+			}
+			if strings.HasPrefix(line, `\`) || strings.HasPrefix(line, "!") {
+				if err := s.command(line); err != nil {
+					if !interactive {
+						return err
+					}
+					fmt.Fprintf(s.out, "ERROR: %s\n", err)
+				}
+				continue
+			}
+		}
+		buffer += scanner.Text() + "\n"
+		if !strings.HasSuffix(line, ";") {
+			continue
+		}
+		if statements, ok := s.completeStatements(buffer); ok {
+			buffer = ""
+			for _, statement := range statements {
+				if err := s.run(statement); err != nil && !interactive {
+					return err
+				}
+			}
+		}
+	}
+	if interactive {
+		fmt.Fprintln(s.out)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	statements, err := imosql.SplitStatements(s.con.Dialect(), buffer)
+	if err != nil {
+		// The server reports the error in the unterminated statement.
+		statements = []string{buffer}
+	}
+	for _, statement := range statements {
+		if err := s.run(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// completeStatements splits buffer into statements if its last statement is
+// terminated by a semicolon outside string literals and comments.
+func (s *Shell) completeStatements(buffer string) ([]string, bool) {
+	dialect := s.con.Dialect()
+	statements, err := imosql.SplitStatements(dialect, buffer)
+	if err != nil || len(statements) == 0 {
+		return nil, false
+	}
+	// Code following a terminated statement is split into a new statement,
+	// otherwise it continues the last statement.
+	next, err := imosql.SplitStatements(dialect, buffer+"\nNULL")
+	if err != nil || len(next) == len(statements) {
+		return nil, false
+	}
+	return statements, true
+}
+
+func (s *Shell) command(line string) error {
+	if strings.HasPrefix(line, "!") {
+		index, err := strconv.Atoi(line[1:])
+		if err != nil || index < 1 || index > len(s.history) {
+			return fmt.Errorf("no such history: %s", line)
+		}
+		return s.run(s.history[index-1])
+	}
+	switch line {
+	case `\history`:
+		for index, statement := range s.history {
+			fmt.Fprintf(s.out, "%5d  %s\n", index+1, statement)
+		}
+	case `\timing`:
+		s.Timing = !s.Timing
+		fmt.Fprintf(s.out, "Timing is %s.\n", map[bool]string{true: "on", false: "off"}[s.Timing])
+	case `\help`, `\?`:
+		fmt.Fprint(s.out, `Statements end with a semicolon and may span multiple lines.
+  \history  Shows statements run before.
+  !N        Runs the N-th statement in history again.
+  \timing   Toggles timing output.
+  \q        Quits.
+`)
+	default:
+		return fmt.Errorf("unknown command: %s (see \\help)", line)
+	}
+	return nil
+}
+
+// returnsRows returns true iff a statement returns rows.
+func returnsRows(statement string) bool {
+	words := strings.Fields(strings.TrimLeft(statement, "( \t\r\n"))
+	if len(words) == 0 {
+		return false
+	}
+	switch strings.ToUpper(words[0]) {
+	case "SELECT", "SHOW", "DESCRIBE", "DESC", "EXPLAIN", "WITH", "PRAGMA",
+		"VALUES", "TABLE":
+		return true
+	}
+	return false
+}
+
+// run runs a statement and prints its result.  An error is printed and also
+// returned.
+func (s *Shell) run(statement string) error {
+	statement = strings.TrimSpace(statement)
+	statement = strings.TrimSpace(strings.TrimSuffix(statement, ";"))
+	if statement == "" {
+		return nil
+	}
+	s.addHistory(statement)
+	start := s.now()
+	var summary string
+	if returnsRows(statement) {
+		columns, rows, err := s.query(statement)
+		if err != nil {
+			fmt.Fprintf(s.out, "ERROR: %s\n", err)
+			return err
+		}
+		writeTable(s.out, columns, rows)
+		summary = fmt.Sprintf("%d rows in set", len(rows))
+		if len(rows) == 1 {
+			summary = "1 row in set"
+		}
+	} else {
+		result, err := s.session.Execute(statement)
+		if err != nil {
+			fmt.Fprintf(s.out, "ERROR: %s\n", err)
+			return err
+		}
+		summary = "Query OK"
+		if rowsAffected, err := result.RowsAffected(); err == nil {
+			summary += fmt.Sprintf(", %d rows affected", rowsAffected)
+		}
+	}
+	if s.Timing {
+		summary += fmt.Sprintf(" (%.3f sec)", s.now().Sub(start).Seconds())
+	}
+	fmt.Fprintf(s.out, "%s\n\n", summary)
+	return nil
+}
+
+// query runs a statement returning rows, whose values are read by position
+// so that columns with the same name (e.g. a.id and b.id) are kept.
+func (s *Shell) query(statement string) ([]string, [][]sql.NullString, error) {
+	rows, err := s.session.Query(statement)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	result := [][]sql.NullString{}
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for index := range values {
+			pointers[index] = &values[index]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, nil, err
+		}
+		result = append(result, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return columns, result, nil
+}
+
+// writeTable prints rows as an aligned table with borders.  NULL values are
+// printed as NULL.
+func writeTable(w io.Writer, columns []string, rows [][]sql.NullString) {
+	if len(columns) == 0 {
+		return
+	}
+	cells := make([][]string, len(rows))
+	widths := make([]int, len(columns))
+	for columnIndex, column := range columns {
+		widths[columnIndex] = utf8.RuneCountInString(column)
+	}
+	for rowIndex, row := range rows {
+		cells[rowIndex] = make([]string, len(columns))
+		for columnIndex := range columns {
+			value := "NULL"
+			if row[columnIndex].Valid {
+				value = row[columnIndex].String
+			}
+			value = strings.NewReplacer("\n", `\n`, "\t", `\t`).Replace(value)
+			cells[rowIndex][columnIndex] = value
+			if width := utf8.RuneCountInString(value); width > widths[columnIndex] {
+				widths[columnIndex] = width
+			}
+		}
+	}
+	border := "+"
+	for _, width := range widths {
+		border += strings.Repeat("-", width+2) + "+"
+	}
+	writeLine := func(values []string) {
+		line := "|"
+		for index, value := range values {
+			line += " " + value +
+				strings.Repeat(" ", widths[index]-utf8.RuneCountInString(value)) + " |"
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintln(w, border)
+	writeLine(columns)
+	fmt.Fprintln(w, border)
+	for _, row := range cells {
+		writeLine(row)
+	}
+	fmt.Fprintln(w, border)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"github.com/imos/imosql/imosqltest"
+	"github.com/imos/imosql/imosqltest/fakedb"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestShell(t *testing.T) (*Shell, *imosqltest.Database, *bytes.Buffer) {
+	con, fake := fakedb.Open(t)
+	output := &bytes.Buffer{}
+	shell := NewShell(con, output)
+	clock := time.Unix(0, 0)
+	shell.now = func() time.Time {
+		clock = clock.Add(250 * time.Millisecond)
+		return clock
+	}
+	return shell, fake, output
+}
+
+func TestShell_Run(t *testing.T) {
+	shell, fake, output := newTestShell(t)
+	fake.Expect("SELECT user_id, user_name FROM users WHERE user_id IN (1, 2)").
+		Returns([]string{"user_id", "user_name"},
+			[]interface{}{1, "foo"}, []interface{}{2, nil})
+	fake.Expect("UPDATE users SET user_name = 'bar'").ReturnsResult(0, 2)
+	input := "SELECT user_id, user_name\n" +
+		"  FROM users WHERE user_id IN (1, 2);\n" +
+		"\n" +
+		"UPDATE users SET user_name = 'bar'"
+	if err := shell.Run(strings.NewReader(input), false); err != nil {
+		t.Fatalf("failed to run: %s", err)
+	}
+	expected := `+---------+-----------+
+| user_id | user_name |
++---------+-----------+
+| 1       | foo       |
+| 2       | NULL      |
++---------+-----------+
+2 rows in set (0.250 sec)
+
+Query OK, 2 rows affected (0.250 sec)
+
+`
+	if output.String() != expected {
+		t.Errorf("unexpected output:\n%s", output.String())
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestShell_History(t *testing.T) {
+	shell, fake, output := newTestShell(t)
+	directory, err := ioutil.TempDir("", "imosql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	shell.HistoryFile = filepath.Join(directory, "history")
+	shell.Timing = false
+	fake.Expect("SELECT 1").Returns([]string{"1"}, []interface{}{1})
+	fake.Expect("SELECT 1").Returns([]string{"1"}, []interface{}{1})
+	input := "SELECT\n1;\n!1\n\\history\n\\q\nSELECT 2;\n"
+	if err := shell.Run(strings.NewReader(input), true); err != nil {
+		t.Fatalf("failed to run: %s", err)
+	}
+	table := "+---+\n| 1 |\n+---+\n| 1 |\n+---+\n1 row in set\n\n"
+	expected := "imosql>      -> " + table + "imosql> " + table +
+		"imosql>     1  SELECT 1\n    2  SELECT 1\nimosql> "
+	if output.String() != expected {
+		t.Errorf("unexpected output:\n%s", output.String())
+	}
+	history, err := ioutil.ReadFile(shell.HistoryFile)
+	if err != nil {
+		t.Fatalf("failed to read history: %s", err)
+	}
+	if string(history) != "SELECT 1\nSELECT 1\n" {
+		t.Errorf("unexpected history: %q", history)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestShell_Error(t *testing.T) {
+	shell, _, output := newTestShell(t)
+	if err := shell.Run(strings.NewReader("\\unknown\n"), true); err != nil {
+		t.Errorf("an interactive shell should continue after errors: %s", err)
+	}
+	if !strings.Contains(output.String(), "ERROR: unknown command") {
+		t.Errorf("unexpected output: %s", output.String())
+	}
+	if err := shell.Run(strings.NewReader("\\unknown\n"), false); err == nil {
+		t.Errorf("a non-interactive shell should stop at errors.")
+	}
+}
+
+func TestShell_MultiLineLiteral(t *testing.T) {
+	shell, fake, output := newTestShell(t)
+	shell.Timing = false
+	fake.Expect("INSERT INTO notes VALUES ('a;\nb;')").ReturnsResult(0, 1)
+	fake.Expect("SELECT a.id, b.id -- ids;\n FROM a, b").Returns(
+		[]string{"id", "id"}, []interface{}{1, 2})
+	input := "INSERT INTO notes VALUES ('a;\nb;');\n" +
+		"SELECT a.id, b.id -- ids;\n FROM a, b;\n"
+	if err := shell.Run(strings.NewReader(input), false); err != nil {
+		t.Fatalf("failed to run: %s", err)
+	}
+	expected := "Query OK, 1 rows affected\n\n" +
+		"+----+----+\n| id | id |\n+----+----+\n| 1  | 2  |\n+----+----+\n" +
+		"1 row in set\n\n"
+	if output.String() != expected {
+		t.Errorf("unexpected output:\n%s", output.String())
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
@@ -10,7 +10,27 @@ import (
 // Connection stores a SQL conneciton and provides main utility functions of
 // ImoSQL.
 type Connection struct {
-	sql *sql.DB
+	sql     *sql.DB
+	dialect Dialect
+	clock   serverClock
+	// tx is a transaction and conn is a dedicated connection which the
+	// connection runs queries in, and parent is the connection which created
+	// the connection.  They are nil unless the connection is created by
+	// Connection.Begin or Connection.Session.
+	tx     *sql.Tx
+	conn   *sql.Conn
+	parent *Connection
+	// retryPolicy is nil unless set by Connection.SetRetryPolicy.
+	retryPolicy *RetryPolicy
+	// replicas is the replicas of the root connection.  primaryOnly disables
+	// reading from them, and lastWrite is the time of the last write in
+	// nanoseconds for read-your-writes pinning.
+	replicas    *replicaSet
+	primaryOnly bool
+	lastWrite   int64
+	// sharesWrites makes writes recorded on the parent, which is true for a
+	// Connection created by Connection.NoRetry.
+	sharesWrites bool
 }
 
 var connection *Connection = nil
@@ -25,11 +45,13 @@ var dataSourceName = flag.String(
 // driver-specific data source name, which are the same arguments as
 // the database/sql package uses.
 func Open(defaultDriverName string, defaultDataSourceName string) (connection *Connection, err error) {
-	connection = new(Connection)
+	connection = &Connection{replicas: &replicaSet{}}
 	if *dataSourceName != "" {
 		connection.sql, err = sql.Open(*driverName, *dataSourceName)
+		connection.dialect = dialectForDriver(*driverName)
 	} else {
 		connection.sql, err = sql.Open(defaultDriverName, defaultDataSourceName)
+		connection.dialect = dialectForDriver(defaultDriverName)
 	}
 	if err != nil {
 		err = errorf("failed to connect to the databse: %s", err)
@@ -53,6 +75,40 @@ func (c *Connection) Ping() error {
 	return c.sql.Ping()
 }
 
+// Dialect returns the Dialect of the connection.
+func (c *Connection) Dialect() Dialect {
+	if c.dialect == nil {
+		return MySQLDialect{}
+	}
+	return c.dialect
+}
+
+// SetDialect overrides the Dialect chosen by the driver name.
+func (c *Connection) SetDialect(dialect Dialect) {
+	c.dialect = dialect
+}
+
+// prepareQuery expands In arguments and replaces positional placeholders (?)
+// with the ones of the dialect.
+func (c *Connection) prepareQuery(query string, args []interface{}) (string, []interface{}, error) {
+	query, args, err := expandArgs(c.Dialect(), query, args)
+	if err != nil {
+		return "", nil, err
+	}
+	if c.Dialect().Placeholder(1) == "?" {
+		return query, args, nil
+	}
+	index := 0
+	query, err = rewritePlaceholders(c.Dialect(), query, func(name string) (string, error) {
+		if name != "" {
+			return ":" + name, nil
+		}
+		index++
+		return c.Dialect().Placeholder(index), nil
+	})
+	return query, args, err
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // No-value query functions
 ////////////////////////////////////////////////////////////////////////////////
@@ -63,8 +119,12 @@ func (c *Connection) Ping() error {
 // logging is enabled, this function tries to output the last insert ID and the
 // number of affected rows by the query.
 func (c *Connection) Execute(query string, args ...interface{}) (result sql.Result, err error) {
+	query, args, err = c.prepareQuery(query, args)
+	if err != nil {
+		return
+	}
 	printLogf("running a SQL command: %s; %v.", query, args)
-	result, err = c.sql.Exec(query, args...)
+	result, err = c.queryer().Exec(query, args...)
 	if err != nil {
 		err = errorf("failed to run a SQL command: %s", err)
 		return
@@ -146,8 +206,12 @@ func (c *Connection) parseSingleValue(result interface{}, query string, args ...
 			"result must be a pointer but %s.",
 			reflect.TypeOf(result).Kind().String())
 	}
+	query, args, err := c.prepareQuery(query, args)
+	if err != nil {
+		return err
+	}
 	printLogf("running a SQL query: %s; %v.", query, args)
-	rows, err := c.sql.Query(query, args...)
+	rows, err := c.queryer().Query(query, args...)
 	if err != nil {
 		return errorf("failed to run a SQL query: %s", err)
 	}
@@ -166,7 +230,7 @@ func (c *Connection) parseSingleValue(result interface{}, query string, args ...
 	if err != nil {
 		return errorf("failed to scan one field: %s", err)
 	}
-	err = parseField(reflect.ValueOf(result), stringResult)
+	err = parseField(reflect.ValueOf(result), stringResult, c.Dialect())
 	if err != nil {
 		return errorf("failed to parse a field: %s", err)
 	}
@@ -221,8 +285,12 @@ func (c *Connection) parseRows(rowsPtr interface{}, limit int, query string, arg
 	if err != nil {
 		return errorf("failed to create a RowReader: %s", err)
 	}
+	query, args, err = c.prepareQuery(query, args)
+	if err != nil {
+		return err
+	}
 	printLogf("running a SQL query: %s; %v.", query, args)
-	inputRows, err := c.sql.Query(query, args...)
+	inputRows, err := c.queryer().Query(query, args...)
 	if err != nil {
 		return errorf("failed to run a SQL query: %s", err)
 	}
@@ -235,6 +303,7 @@ func (c *Connection) parseRows(rowsPtr interface{}, limit int, query string, arg
 		return errorf("no columns.")
 	}
 	rowReader.SetColumns(columns)
+	rowReader.SetDialect(c.Dialect())
 	if err := rowReader.Read(inputRows, limit); err != nil {
 		return errorf("failed to read rows: %s", err)
 	}
@@ -283,3 +352,153 @@ func (c *Connection) RowOrDie(rowPtr interface{}, query string, args ...interfac
 	}
 	return found
 }
+
+// RowsByKey fills mapPtr with a result for a given SQL query, indexing rows by
+// the value of keyColumn.  mapPtr must be a pointer to map[K]Struct or
+// map[K][]Struct, and Struct must have a field whose sql tag is keyColumn,
+// whose type is assignable to K and is not a pointer.  If the map has struct
+// values, RowsByKey returns an error when two rows share the same key.  If
+// the map has slice values, rows sharing the same key are appended in the
+// order of the query result.
+func (c *Connection) RowsByKey(mapPtr interface{}, keyColumn string, query string, args ...interface{}) error {
+	if reflect.ValueOf(mapPtr).Kind() != reflect.Ptr {
+		return errorf(
+			"mapPtr must be a pointer but %s.",
+			reflect.ValueOf(mapPtr).Kind().String())
+	}
+	mapType := reflect.TypeOf(mapPtr).Elem()
+	if mapType.Kind() != reflect.Map {
+		return errorf("mapPtr must point to a map but %s.", mapType.Kind().String())
+	}
+	rowType := mapType.Elem()
+	isUnique := true
+	if rowType.Kind() == reflect.Slice {
+		rowType = rowType.Elem()
+		isUnique = false
+	}
+	if rowType.Kind() != reflect.Struct {
+		return errorf(
+			"map values must be a struct or a slice of a struct but %s.",
+			mapType.Elem().String())
+	}
+	keyFieldIndex := -1
+	for fieldIndex := 0; fieldIndex < rowType.NumField(); fieldIndex++ {
+		if ColumnName(rowType.Field(fieldIndex)) == keyColumn {
+			keyFieldIndex = fieldIndex
+			break
+		}
+	}
+	if keyFieldIndex < 0 {
+		return errorf("no field has a sql tag for the key column: %s.", keyColumn)
+	}
+	keyFieldType := rowType.Field(keyFieldIndex).Type
+	if keyFieldType.Kind() == reflect.Ptr {
+		return errorf("a key field must not be a pointer but %s.", keyFieldType.String())
+	}
+	if !keyFieldType.AssignableTo(mapType.Key()) {
+		return errorf(
+			"a key field of %s cannot be assigned to a map key of %s.",
+			keyFieldType.String(), mapType.Key().String())
+	}
+	rowsPtr := reflect.New(reflect.SliceOf(rowType))
+	if err := c.parseRows(rowsPtr.Interface(), -1, query, args...); err != nil {
+		return err
+	}
+	result := reflect.MakeMap(mapType)
+	rows := rowsPtr.Elem()
+	for rowIndex := 0; rowIndex < rows.Len(); rowIndex++ {
+		row := rows.Index(rowIndex)
+		key := row.Field(keyFieldIndex)
+		if isUnique {
+			if result.MapIndex(key).IsValid() {
+				return errorf("duplicate key: %v.", key.Interface())
+			}
+			result.SetMapIndex(key, row)
+			continue
+		}
+		values := result.MapIndex(key)
+		if !values.IsValid() {
+			values = reflect.MakeSlice(mapType.Elem(), 0, 1)
+		}
+		result.SetMapIndex(key, reflect.Append(values, row))
+	}
+	reflect.ValueOf(mapPtr).Elem().Set(result)
+	return nil
+}
+
+// RowsByKeyOrDie runs Connection.RowsByKey.  If Connection.RowsByKey fails,
+// this function panics.
+func (c *Connection) RowsByKeyOrDie(mapPtr interface{}, keyColumn string, query string, args ...interface{}) {
+	err := c.RowsByKey(mapPtr, keyColumn, query, args...)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Query runs a SQL query using DB.Query.  This is primitive and returns
+// sql.Rows, which must be closed by the caller.  This is useful to stream a
+// large result, otherwise Connection.Rows or Connection.MapRows should be used
+// instead.
+func (c *Connection) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	query, args, err := c.prepareQuery(query, args)
+	if err != nil {
+		return nil, err
+	}
+	printLogf("running a SQL query: %s; %v.", query, args)
+	rows, err := c.queryer().Query(query, args...)
+	if err != nil {
+		return nil, errorf("failed to run a SQL query: %s", err)
+	}
+	return rows, nil
+}
+
+// MapRows returns rows for a given SQL query as maps from column names to
+// values with the columns in their order, which is useful for queries whose
+// columns are unknown beforehand (e.g. queries given by users).  NULL values
+// are missing in the maps.  If multiple columns share the same name, the last
+// one wins.
+func (c *Connection) MapRows(query string, args ...interface{}) (columns []string, rows []map[string]string, err error) {
+	inputRows, err := c.Query(query, args...)
+	if err != nil {
+		return
+	}
+	defer inputRows.Close()
+	columns, err = inputRows.Columns()
+	if err != nil {
+		err = errorf("failed to get columns: %s", err)
+		return
+	}
+	fields := make([]sql.NullString, len(columns))
+	interfaceFields := make([]interface{}, len(fields))
+	for fieldIndex := range fields {
+		interfaceFields[fieldIndex] = &fields[fieldIndex]
+	}
+	rows = []map[string]string{}
+	for inputRows.Next() {
+		if err = inputRows.Scan(interfaceFields...); err != nil {
+			err = errorf("failed to read rows: %s", err)
+			return
+		}
+		row := map[string]string{}
+		for fieldIndex, field := range fields {
+			if field.Valid {
+				row[columns[fieldIndex]] = field.String
+			}
+		}
+		rows = append(rows, row)
+	}
+	if err = inputRows.Err(); err != nil {
+		err = errorf("failed to read rows: %s", err)
+	}
+	return
+}
+
+// MapRowsOrDie runs Connection.MapRows.  If Connection.MapRows fails, this
+// function panics.
+func (c *Connection) MapRowsOrDie(query string, args ...interface{}) ([]string, []map[string]string) {
+	columns, rows, err := c.MapRows(query, args...)
+	if err != nil {
+		panic(err)
+	}
+	return columns, rows
+}
@@ -0,0 +1,246 @@
+package imosql_test
+
+import (
+	imosql "."
+	"errors"
+	"github.com/imos/imosql/imosqltest"
+	"testing"
+	"time"
+)
+
+// openFakeDatabase is fakedb.Open for the tests of this package, which
+// import the package as "." and so cannot share Connection with fakedb.
+func openFakeDatabase(t *testing.T) (*imosql.Connection, *imosqltest.Database) {
+	fake := imosqltest.NewDatabase()
+	con, err := imosql.Open(imosqltest.DriverName, fake.DataSourceName())
+	if err != nil {
+		t.Fatalf("failed to open a fake database: %s", err)
+	}
+	return con, fake
+}
+
+var testColumns = []string{"test_id", "test_string", "test_int", "test_time"}
+
+func TestConnection_Fake(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	fake.Expect("SELECT 1 + 1").Returns([]string{"1 + 1"}, []interface{}{2})
+	fake.Expect("SELECT * FROM test WHERE test_id IN (?, ?, ?)", 1, 2, 4).
+		Returns(
+			testColumns,
+			[]interface{}{1, "foo", 1, "2000-01-01 00:00:00"},
+			[]interface{}{2, "bar", 2, "2001-02-03 04:05:06"})
+	fake.Expect("SELECT * FROM test WHERE test_id = ?", 3).Returns(testColumns)
+	fake.Expect("UPDATE test SET test_int = ? WHERE test_id = ?", 5, 1).
+		ReturnsResult(0, 1)
+	fake.Expect("UPDATE test SET test_int = ? WHERE test_id = ?", 5, 1).
+		ReturnsResult(0, 0)
+	if actual := con.IntegerOrDie("SELECT 1 + 1"); actual != 2 {
+		t.Errorf("expected: 2, actual: %d.", actual)
+	}
+	rows := map[int][]TestRow{}
+	con.RowsByKeyOrDie(
+		&rows, "test_id", "SELECT * FROM test WHERE test_id IN (?)",
+		imosql.In([]int{1, 2, 4}))
+	checkInterfaceEqual(
+		t,
+		`{"1": [{"Id": 1, "String": "foo", "Int": 1, "Time": "2000-01-01T00:00:00Z"}],
+		  "2": [{"Id": 2, "String": "bar", "Int": 2, "Time": "2001-02-03T04:05:06Z"}]}`,
+		rows)
+	row := TestRow{}
+	if con.RowOrDie(&row, "SELECT * FROM test WHERE test_id = ?", 3) {
+		t.Errorf("there should be no results for test_id = 3.")
+	}
+	arg := map[string]interface{}{"id": 1, "int": 5}
+	if err := con.ChangeNamed(
+		"UPDATE test SET test_int = :int WHERE test_id = :id", arg); err != nil {
+		t.Errorf("failed to change: %s", err)
+	}
+	if err := con.ChangeNamed(
+		"UPDATE test SET test_int = :int WHERE test_id = :id", arg); err == nil {
+		t.Errorf("Change should fail if no rows are updated.")
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnection_PostgreSQL(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	con.SetDialect(imosql.PostgreSQLDialect{})
+	fake.Expect("SELECT * FROM test WHERE test_id = $1 AND test_int IN ($2, $3)").
+		Returns(testColumns, []interface{}{1, "foo", 1, "2000-01-01 00:00:00"})
+	rows := []TestRow{}
+	con.RowsOrDie(
+		&rows, "SELECT * FROM test WHERE test_id = ? AND test_int IN (?)",
+		1, imosql.In([]int{1, 2}))
+	if len(rows) != 1 || rows[0].String != "foo" {
+		t.Errorf("unexpected rows: %#v.", rows)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnection_DialectSyntax(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	con.SetDialect(imosql.PostgreSQLDialect{})
+	// A backslash does not escape a quote in a standard string, but it does
+	// in an escape string.
+	fake.Expect(`SELECT '\', $1, E'\'?', $2, $$?$$, $tag$'?$tag$, $3`, 1, 2, 3).
+		Returns([]string{"a"}, []interface{}{1})
+	con.IntegerOrDie(`SELECT '\', ?, E'\'?', ?, $$?$$, $tag$'?$tag$, ?`, 1, 2, 3)
+	con.SetDialect(imosql.SQLiteDialect{})
+	// # does not start a comment in SQLite.
+	fake.Expect("SELECT 1 # ?, ?, ? -- ?", 1, 2, 3).
+		Returns([]string{"a"}, []interface{}{1})
+	con.IntegerOrDie("SELECT 1 # ?, ? -- ?", 1, imosql.In([]int{2, 3}))
+	con.SetDialect(imosql.MySQLDialect{})
+	fake.Expect("SELECT '\\'?', ?, ? # ?", 1, 2).
+		Returns([]string{"a"}, []interface{}{1})
+	con.IntegerOrDie("SELECT '\\'?', ? # ?", imosql.In([]int{1, 2}))
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnection_Transaction(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	fake.Expect(
+		"INSERT INTO `test` (`test_id`, `test_string`, `test_int`, `test_time`) "+
+			"VALUES (?, ?, ?, ?)",
+		4, "baz", int64(4), time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)).
+		ReturnsResult(4, 1)
+	fake.Expect("INSERT INTO `test` (`test_id`, `test_string`) VALUES (?, ?)",
+		5, "qux").ReturnsResult(5, 1)
+	err := con.Transaction(func(tx *imosql.Connection) error {
+		if !tx.InTransaction() {
+			t.Errorf("tx must be in a transaction.")
+		}
+		tx.InsertOrDie("test", TestRow{
+			Id: 4, String: "baz", Int: 4,
+			Time: time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)})
+		tx.InsertOrDie(
+			"test", map[string]interface{}{"test_string": "qux", "test_id": 5})
+		return nil
+	})
+	if err != nil {
+		t.Errorf("failed to run a transaction: %s", err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+	expectedErr := errors.New("rollback")
+	if err := con.Transaction(func(tx *imosql.Connection) error {
+		return expectedErr
+	}); err != expectedErr {
+		t.Errorf("unexpected error: %v.", err)
+	}
+}
+
+func TestConnection_InsertAutoIncrement(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	type autoIncrementRow struct {
+		Id   int64  `sql:"test_id,autoincrement"`
+		Name string `sql:"test_name"`
+	}
+	fake.Expect("INSERT INTO `test` (`test_name`) VALUES (?)", "foo").
+		ReturnsResult(1, 1)
+	fake.Expect("INSERT INTO `test` (`test_id`, `test_name`) VALUES (?, ?)",
+		int64(5), "bar").ReturnsResult(5, 1)
+	con.InsertOrDie("test", autoIncrementRow{Name: "foo"})
+	con.InsertOrDie("test", &autoIncrementRow{Id: 5, Name: "bar"})
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnection_Close(t *testing.T) {
+	con, _ := openFakeDatabase(t)
+	session, err := con.Session()
+	if err != nil {
+		t.Fatalf("failed to start a session: %s", err)
+	}
+	if err := session.Close(); err != nil {
+		t.Errorf("failed to close a session: %s", err)
+	}
+	if err := con.Scope().Close(); err == nil {
+		t.Errorf("Close should fail for a scope.")
+	}
+	if err := con.Close(); err != nil {
+		t.Errorf("failed to close the database: %s", err)
+	}
+	if err := con.Ping(); err == nil {
+		t.Errorf("Ping should fail after Close.")
+	}
+}
+
+func TestConnection_TestTransaction(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	fake.Expect("DELETE FROM test").ReturnsResult(0, 3)
+	t.Run("Isolated", func(t *testing.T) {
+		tx := con.TestTransaction(t)
+		tx.ChangeOrDie("DELETE FROM test")
+	})
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnection_TestDatabase(t *testing.T) {
+	openDatabase()
+	if db == nil {
+		return
+	}
+	testDb := db.TestDatabase(t)
+	testDb.CommandOrDie("CREATE TABLE test (test_id INT PRIMARY KEY)")
+	testDb.CommandOrDie("INSERT INTO test VALUES (1)")
+	if actual := testDb.IntegerOrDie("SELECT COUNT(*) FROM test"); actual != 1 {
+		t.Errorf("expected: 1, actual: %d.", actual)
+	}
+}
+
+func TestConnection_MapRows(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	fake.Expect("SELECT * FROM test WHERE test_id IN (?, ?)", 1, 2).Returns(
+		testColumns,
+		[]interface{}{1, "foo", nil, "2000-01-01 00:00:00"},
+		[]interface{}{2, "bar", 2, nil})
+	columns, rows := con.MapRowsOrDie(
+		"SELECT * FROM test WHERE test_id IN (?)", imosql.In([]int{1, 2}))
+	checkInterfaceEqual(t, `["test_id", "test_string", "test_int", "test_time"]`, columns)
+	checkInterfaceEqual(
+		t,
+		`[{"test_id": "1", "test_string": "foo", "test_time": "2000-01-01 00:00:00"},
+		  {"test_id": "2", "test_string": "bar", "test_int": "2"}]`,
+		rows)
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnection_RowsByKeyTypes(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	// A key field of int64 must not be converted into string keys (e.g. 65
+	// into "A").
+	rowsByString := map[string]TestRow{}
+	if err := con.RowsByKey(&rowsByString, "test_int", "SELECT * FROM test"); err == nil {
+		t.Errorf("RowsByKey should fail for int64 fields and string keys.")
+	}
+	type pointerRow struct {
+		Id *int `sql:"test_id"`
+	}
+	rowsByPointer := map[*int]pointerRow{}
+	if err := con.RowsByKey(&rowsByPointer, "test_id", "SELECT * FROM test"); err == nil {
+		t.Errorf("RowsByKey should fail for pointer key fields.")
+	}
+	fake.Expect("SELECT * FROM test").Returns(
+		testColumns, []interface{}{1, "foo", 65, "2000-01-01 00:00:00"})
+	rowsByInterface := map[interface{}]TestRow{}
+	con.RowsByKeyOrDie(&rowsByInterface, "test_int", "SELECT * FROM test")
+	if row, ok := rowsByInterface[int64(65)]; !ok || row.Id != 1 {
+		t.Errorf("unexpected rows: %#v.", rowsByInterface)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
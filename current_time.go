@@ -1,19 +1,192 @@
 package imosql
 
 import (
+	"sync"
 	"time"
 )
 
-var lastAdjustTime int64 = 0
-var timeGapInNanoseconds *int64 = nil
+// DefaultClockSyncInterval is the default interval to synchronize the clock
+// with the server's.
+const DefaultClockSyncInterval = 600 * time.Second
 
+// ClockSyncMode specifies how to estimate the gap between the local clock and
+// the server's clock.
+type ClockSyncMode int
+
+const (
+	// ClockSyncSingle queries the server's time once and regards the gap as the
+	// difference between the local time after the query and the server's time.
+	ClockSyncSingle ClockSyncMode = iota
+	// ClockSyncRoundTrip queries the server's time several times, compensates
+	// for half the round-trip time of each query and adopts the sample with the
+	// shortest round trip.  It uses a fractional-second function of the server
+	// if the dialect provides one.
+	ClockSyncRoundTrip
+)
+
+// DefaultClockSyncSamples is the default number of samples for
+// ClockSyncRoundTrip.
+const DefaultClockSyncSamples = 5
+
+// ClockSkew is an estimated gap between the local clock and the server's
+// clock.
+type ClockSkew struct {
+	// Offset is the local time minus the server's time.
+	Offset time.Duration
+	// Uncertainty is the maximum error of Offset.  The actual gap should be in
+	// [Offset - Uncertainty, Offset + Uncertainty].
+	Uncertainty time.Duration
+	// SyncTime is the local time when Offset is estimated.
+	SyncTime time.Time
+}
+
+// preciseCurrentTimeDialect is implemented by a Dialect whose default
+// current-time query truncates fractional seconds but which provides a more
+// precise one for newer servers.
+type preciseCurrentTimeDialect interface {
+	PreciseCurrentTimeQuery() string
+}
+
+// serverClock stores the gap between the local clock and the server's clock.
+// Every Connection has its own serverClock because servers may have
+// different clocks.
+type serverClock struct {
+	mutex              sync.Mutex
+	isSynced           bool
+	skew               ClockSkew
+	syncInterval       time.Duration
+	syncMode           ClockSyncMode
+	syncSamples        int
+	isPreciseQueryDown bool
+	source             Clock
+}
+
+// SetClockSyncInterval sets the interval to synchronize the clock with the
+// server's.  If interval is not positive, DefaultClockSyncInterval is used.
+func (c *Connection) SetClockSyncInterval(interval time.Duration) {
+	c = c.root()
+	c.clock.mutex.Lock()
+	defer c.clock.mutex.Unlock()
+	c.clock.syncInterval = interval
+}
+
+// SetClockSyncMode sets how to synchronize the clock with the server's.
+// samples is the number of samples for ClockSyncRoundTrip, and
+// DefaultClockSyncSamples is used if it is not positive.  The clock is
+// synchronized again at the next call of Connection.Now.
+func (c *Connection) SetClockSyncMode(mode ClockSyncMode, samples int) {
+	c = c.root()
+	c.clock.mutex.Lock()
+	defer c.clock.mutex.Unlock()
+	c.clock.syncMode = mode
+	c.clock.syncSamples = samples
+	c.clock.isSynced = false
+}
+
+// sampleClockSkew queries the server's time once and estimates the gap.  The
+// server is always the primary because replicas may have different clocks.
+func (c *Connection) sampleClockSkew(query string, compensatesRoundTrip bool) (skew ClockSkew, err error) {
+	startTime := time.Now()
+	serverTime, err := c.Primary().Time(query)
+	if err != nil {
+		return
+	}
+	endTime := time.Now()
+	roundTripTime := endTime.Sub(startTime)
+	// A server time without fractional seconds is likely to be truncated, so
+	// it is regarded as the middle of the second.
+	resolution := time.Duration(0)
+	if serverTime.Nanosecond() == 0 {
+		resolution = time.Second
+		serverTime = serverTime.Add(resolution / 2)
+	}
+	skew.SyncTime = endTime
+	if compensatesRoundTrip {
+		skew.Offset = startTime.Add(roundTripTime / 2).Sub(serverTime)
+		skew.Uncertainty = roundTripTime/2 + resolution/2
+	} else {
+		skew.Offset = endTime.Sub(serverTime)
+		skew.Uncertainty = roundTripTime + resolution/2
+	}
+	return
+}
+
+// syncClock estimates the gap between the local clock and the server's clock.
+// c.clock.mutex must be locked.
+func (c *Connection) syncClock() error {
+	if c.clock.syncMode == ClockSyncSingle {
+		skew, err := c.sampleClockSkew(c.Dialect().CurrentTimeQuery(), false)
+		if err != nil {
+			return err
+		}
+		c.clock.skew = skew
+		return nil
+	}
+	query := c.Dialect().CurrentTimeQuery()
+	if dialect, ok := c.Dialect().(preciseCurrentTimeDialect); ok &&
+		!c.clock.isPreciseQueryDown {
+		if _, err := c.Primary().Time(dialect.PreciseCurrentTimeQuery()); err == nil {
+			query = dialect.PreciseCurrentTimeQuery()
+		} else {
+			printLogf("fractional-second time is unavailable: %s", err)
+			c.clock.isPreciseQueryDown = true
+		}
+	}
+	samples := c.clock.syncSamples
+	if samples <= 0 {
+		samples = DefaultClockSyncSamples
+	}
+	var bestSkew *ClockSkew
+	for sampleIndex := 0; sampleIndex < samples; sampleIndex++ {
+		skew, err := c.sampleClockSkew(query, true)
+		if err != nil {
+			return err
+		}
+		if bestSkew == nil || skew.Uncertainty < bestSkew.Uncertainty {
+			bestSkew = &skew
+		}
+	}
+	c.clock.skew = *bestSkew
+	return nil
+}
+
+// ClockSkew returns the estimated gap between the local clock and the
+// server's clock, synchronizing the clock if necessary.
+func (c *Connection) ClockSkew() (ClockSkew, error) {
+	c = c.root()
+	c.clock.mutex.Lock()
+	defer c.clock.mutex.Unlock()
+	syncInterval := c.clock.syncInterval
+	if syncInterval <= 0 {
+		syncInterval = DefaultClockSyncInterval
+	}
+	if !c.clock.isSynced || time.Since(c.clock.skew.SyncTime) > syncInterval {
+		if err := c.syncClock(); err != nil {
+			return ClockSkew{}, errorf("failed to get the server time: %s", err)
+		}
+		c.clock.isSynced = true
+		printLogf(
+			"the current time gap is %d ms (+/- %d ms).",
+			c.clock.skew.Offset/time.Millisecond,
+			c.clock.skew.Uncertainty/time.Millisecond)
+	}
+	return c.clock.skew, nil
+}
+
+// Now returns the current time of the Clock of the connection.  By default,
+// it is the current time of the server, and this function queries the
+// server's time only once per the clock sync interval and estimates the
+// current time by the local clock in between.
+func (c *Connection) Now() (time.Time, error) {
+	return c.Clock().Now()
+}
+
+// CurrentTime runs Connection.Now.  If Connection.Now fails, this function
+// panics.
 func (c *Connection) CurrentTime() time.Time {
-	if timeGapInNanoseconds == nil || lastAdjustTime < time.Now().Unix()-600 {
-		timeGapInNanoseconds = new(int64)
-		*timeGapInNanoseconds =
-			time.Now().UnixNano() - c.TimeOrDie("SELECT UTC_TIMESTAMP()").UnixNano()
-		printLogf("the current time gap is %d ms.", *timeGapInNanoseconds/1000000)
-		lastAdjustTime = time.Now().Unix()
-	}
-	return time.Unix(0, time.Now().UnixNano()-*timeGapInNanoseconds)
+	result, err := c.Now()
+	if err != nil {
+		panic(err)
+	}
+	return result
 }
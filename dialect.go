@@ -0,0 +1,435 @@
+package imosql
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Dialect abstracts differences among SQL servers.  A Connection chooses its
+// Dialect by its driver name, and Connection.SetDialect overrides it.
+type Dialect interface {
+	// Name returns a human-readable name of the dialect.
+	Name() string
+	// Placeholder returns a placeholder for the index-th argument, where index
+	// starts from 1.
+	Placeholder(index int) string
+	// QuoteIdentifier quotes a table name or a column name.
+	QuoteIdentifier(name string) string
+	// CurrentTimeQuery returns a query which returns the current UTC time of
+	// the server.
+	CurrentTimeQuery() string
+	// Upsert returns a statement inserting a row with columns and updating the
+	// existing row instead if keyColumns conflict.  Its placeholders correspond
+	// to columns in the same order.  If keyColumns is empty, PostgreSQL and
+	// SQLite cannot update a conflicting row, and the row is skipped instead.
+	Upsert(table string, columns []string, keyColumns []string) string
+	// ParseTime parses a time value returned by the server.
+	ParseTime(input string) (time.Time, error)
+	// FormatTime formats a time value so that the server can parse it.
+	FormatTime(t time.Time) string
+	// CreateTable returns statements creating a table if it does not exist.
+	CreateTable(schema *TableSchema) ([]string, error)
+}
+
+// dialectForDriver returns a Dialect for a database/sql driver name.  It falls
+// back to MySQLDialect, which ImoSQL has been designed for.
+func dialectForDriver(driverName string) Dialect {
+	switch driverName {
+	case "postgres", "pgx":
+		return PostgreSQLDialect{}
+	case "sqlite3", "sqlite":
+		return SQLiteDialect{}
+	}
+	return MySQLDialect{}
+}
+
+// parseTimeInLayouts parses input in UTC using the first layout accepting it.
+// Time values scanned through database/sql (e.g. time.Time returned by a
+// driver) come in RFC 3339, so it is always accepted as well.
+func parseTimeInLayouts(input string, layouts ...string) (result time.Time, err error) {
+	location, err := time.LoadLocation("UTC")
+	if err != nil {
+		return
+	}
+	for _, layout := range append(layouts, time.RFC3339Nano) {
+		result, err = time.ParseInLocation(layout, input, location)
+		if err == nil {
+			result = result.In(location)
+			return
+		}
+	}
+	return
+}
+
+func quoteIdentifier(name string, quote string) string {
+	return quote + strings.Replace(name, quote, quote+quote, -1) + quote
+}
+
+func joinIdentifiers(d Dialect, names []string) string {
+	quotedNames := make([]string, len(names))
+	for index, name := range names {
+		quotedNames[index] = d.QuoteIdentifier(name)
+	}
+	return strings.Join(quotedNames, ", ")
+}
+
+func insertStatement(d Dialect, table string, columns []string) string {
+	placeholders := make([]string, len(columns))
+	for index := range columns {
+		placeholders[index] = d.Placeholder(index + 1)
+	}
+	return fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)", d.QuoteIdentifier(table),
+		joinIdentifiers(d, columns), strings.Join(placeholders, ", "))
+}
+
+// nonKeyColumns returns columns which are not contained in keyColumns.
+func nonKeyColumns(columns []string, keyColumns []string) []string {
+	isKey := map[string]bool{}
+	for _, column := range keyColumns {
+		isKey[column] = true
+	}
+	result := []string{}
+	for _, column := range columns {
+		if !isKey[column] {
+			result = append(result, column)
+		}
+	}
+	return result
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// MySQL
+////////////////////////////////////////////////////////////////////////////////
+
+// MySQLDialect is a Dialect for MySQL and MariaDB.
+type MySQLDialect struct{}
+
+func (MySQLDialect) Name() string {
+	return "MySQL"
+}
+
+func (MySQLDialect) Placeholder(index int) string {
+	return "?"
+}
+
+func (MySQLDialect) QuoteIdentifier(name string) string {
+	return quoteIdentifier(name, "`")
+}
+
+func (MySQLDialect) CurrentTimeQuery() string {
+	return "SELECT UTC_TIMESTAMP()"
+}
+
+// PreciseCurrentTimeQuery returns a query for the current time with
+// microseconds, which requires MySQL 5.6.4 or later.
+func (MySQLDialect) PreciseCurrentTimeQuery() string {
+	return "SELECT UTC_TIMESTAMP(6)"
+}
+
+func (d MySQLDialect) Upsert(table string, columns []string, keyColumns []string) string {
+	updateColumns := nonKeyColumns(columns, keyColumns)
+	if len(updateColumns) == 0 {
+		updateColumns = keyColumns[:1]
+	}
+	updates := make([]string, len(updateColumns))
+	for index, column := range updateColumns {
+		updates[index] = fmt.Sprintf(
+			"%s = VALUES(%s)", d.QuoteIdentifier(column), d.QuoteIdentifier(column))
+	}
+	return insertStatement(d, table, columns) +
+		" ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+}
+
+// ParseTime parses a DATETIME or DATE value.  MySQL represents an invalid
+// date as "0000-00-00 00:00:00" (or "0000-00-00" for DATE), so it is parsed as
+// the zero value of time.Time.
+func (MySQLDialect) ParseTime(input string) (time.Time, error) {
+	switch input {
+	case "0000-00-00 00:00:00":
+		input = "0001-01-01 00:00:00"
+	case "0000-00-00":
+		input = "0001-01-01"
+	}
+	return parseTimeInLayouts(input, "2006-01-02 15:04:05", "2006-01-02")
+}
+
+func (MySQLDialect) FormatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05.999999")
+}
+
+func (MySQLDialect) columnType(column ColumnSchema) string {
+	if column.Type == reflect.TypeOf(time.Time{}) {
+		return "DATETIME"
+	}
+	columnType := ""
+	switch column.Type.Kind() {
+	case reflect.Bool:
+		return "TINYINT(1)"
+	case reflect.Int8, reflect.Uint8:
+		columnType = "TINYINT"
+	case reflect.Int16, reflect.Uint16:
+		columnType = "SMALLINT"
+	case reflect.Int32, reflect.Uint32:
+		columnType = "INT"
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		columnType = "BIGINT"
+	case reflect.String:
+		if column.Size > 0 {
+			return fmt.Sprintf("VARCHAR(%d)", column.Size)
+		}
+		// TEXT cannot be a key without a prefix length.
+		if column.PrimaryKey || column.Index || column.Unique {
+			return "VARCHAR(255)"
+		}
+		return "TEXT"
+	}
+	switch column.Type.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		columnType += " UNSIGNED"
+	}
+	return columnType
+}
+
+func (d MySQLDialect) CreateTable(schema *TableSchema) ([]string, error) {
+	definitions := []string{}
+	for _, column := range schema.Columns {
+		definition := columnDefinition(d, column, d.columnType(column))
+		if column.AutoIncrement {
+			definition += " AUTO_INCREMENT"
+		}
+		definitions = append(definitions, definition)
+	}
+	if primaryKey := schema.PrimaryKey(); len(primaryKey) > 0 {
+		definitions = append(definitions,
+			"PRIMARY KEY ("+joinIdentifiers(d, primaryKey)+")")
+	}
+	for _, column := range schema.Columns {
+		if column.Unique {
+			definitions = append(definitions, fmt.Sprintf(
+				"UNIQUE KEY %s (%s)", d.QuoteIdentifier(indexName(schema.Name, column)),
+				d.QuoteIdentifier(column.Name)))
+		} else if column.Index {
+			definitions = append(definitions, fmt.Sprintf(
+				"KEY %s (%s)", d.QuoteIdentifier(indexName(schema.Name, column)),
+				d.QuoteIdentifier(column.Name)))
+		}
+	}
+	return []string{fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (\n  %s\n)", d.QuoteIdentifier(schema.Name),
+		strings.Join(definitions, ",\n  "))}, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PostgreSQL
+////////////////////////////////////////////////////////////////////////////////
+
+// PostgreSQLDialect is a Dialect for PostgreSQL.
+type PostgreSQLDialect struct{}
+
+func (PostgreSQLDialect) Name() string {
+	return "PostgreSQL"
+}
+
+func (PostgreSQLDialect) Placeholder(index int) string {
+	return fmt.Sprintf("$%d", index)
+}
+
+func (PostgreSQLDialect) QuoteIdentifier(name string) string {
+	return quoteIdentifier(name, `"`)
+}
+
+func (PostgreSQLDialect) CurrentTimeQuery() string {
+	// CURRENT_TIMESTAMP is the start time of the current transaction.
+	return "SELECT clock_timestamp() AT TIME ZONE 'UTC'"
+}
+
+func (d PostgreSQLDialect) Upsert(table string, columns []string, keyColumns []string) string {
+	return insertStatement(d, table, columns) +
+		onConflictClause(d, columns, keyColumns)
+}
+
+func (PostgreSQLDialect) ParseTime(input string) (time.Time, error) {
+	return parseTimeInLayouts(
+		input, "2006-01-02 15:04:05", "2006-01-02 15:04:05Z07",
+		"2006-01-02 15:04:05Z07:00", "2006-01-02")
+}
+
+func (PostgreSQLDialect) FormatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05.999999Z07:00")
+}
+
+func (PostgreSQLDialect) columnType(column ColumnSchema) string {
+	if column.Type == reflect.TypeOf(time.Time{}) {
+		return "TIMESTAMP"
+	}
+	switch column.Type.Kind() {
+	case reflect.Bool:
+		return "BOOLEAN"
+	case reflect.Int8, reflect.Int16, reflect.Uint8:
+		if column.AutoIncrement {
+			return "SMALLSERIAL"
+		}
+		return "SMALLINT"
+	case reflect.Int32, reflect.Uint16:
+		if column.AutoIncrement {
+			return "SERIAL"
+		}
+		return "INTEGER"
+	case reflect.Int, reflect.Int64, reflect.Uint32:
+		if column.AutoIncrement {
+			return "BIGSERIAL"
+		}
+		return "BIGINT"
+	case reflect.Uint, reflect.Uint64:
+		return "NUMERIC(20)"
+	case reflect.String:
+		if column.Size > 0 {
+			return fmt.Sprintf("VARCHAR(%d)", column.Size)
+		}
+		return "TEXT"
+	}
+	return ""
+}
+
+func (d PostgreSQLDialect) CreateTable(schema *TableSchema) ([]string, error) {
+	definitions := []string{}
+	for _, column := range schema.Columns {
+		if column.AutoIncrement {
+			switch column.Type.Kind() {
+			case reflect.Uint, reflect.Uint64, reflect.Bool, reflect.String:
+				return nil, errorf(
+					"%s cannot be auto-incremented in PostgreSQL.", column.Name)
+			}
+		}
+		// BOOLEAN does not accept integers, which are the default values of
+		// booleans in the other dialects.
+		if column.Type.Kind() == reflect.Bool && column.Default != nil {
+			var defaultValue string
+			switch *column.Default {
+			case "0":
+				defaultValue = "FALSE"
+			case "1":
+				defaultValue = "TRUE"
+			}
+			if defaultValue != "" {
+				column.Default = &defaultValue
+			}
+		}
+		definitions = append(definitions,
+			columnDefinition(d, column, d.columnType(column)))
+	}
+	if primaryKey := schema.PrimaryKey(); len(primaryKey) > 0 {
+		definitions = append(definitions,
+			"PRIMARY KEY ("+joinIdentifiers(d, primaryKey)+")")
+	}
+	return append([]string{fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (\n  %s\n)", d.QuoteIdentifier(schema.Name),
+		strings.Join(definitions, ",\n  "))},
+		indexStatements(d, schema)...), nil
+}
+
+// onConflictClause returns an ON CONFLICT clause, which is shared by
+// PostgreSQL and SQLite.  Without keyColumns, the clause has no conflict
+// target, which allows only DO NOTHING.
+func onConflictClause(d Dialect, columns []string, keyColumns []string) string {
+	if len(keyColumns) == 0 {
+		return " ON CONFLICT DO NOTHING"
+	}
+	updateColumns := nonKeyColumns(columns, keyColumns)
+	clause := " ON CONFLICT (" + joinIdentifiers(d, keyColumns) + ")"
+	if len(updateColumns) == 0 {
+		return clause + " DO NOTHING"
+	}
+	updates := make([]string, len(updateColumns))
+	for index, column := range updateColumns {
+		updates[index] = fmt.Sprintf(
+			"%s = excluded.%s", d.QuoteIdentifier(column), d.QuoteIdentifier(column))
+	}
+	return clause + " DO UPDATE SET " + strings.Join(updates, ", ")
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SQLite
+////////////////////////////////////////////////////////////////////////////////
+
+// SQLiteDialect is a Dialect for SQLite 3.24.0 or later.
+type SQLiteDialect struct{}
+
+func (SQLiteDialect) Name() string {
+	return "SQLite"
+}
+
+func (SQLiteDialect) Placeholder(index int) string {
+	return "?"
+}
+
+func (SQLiteDialect) QuoteIdentifier(name string) string {
+	return quoteIdentifier(name, `"`)
+}
+
+func (SQLiteDialect) CurrentTimeQuery() string {
+	return "SELECT STRFTIME('%Y-%m-%d %H:%M:%f', 'now')"
+}
+
+func (d SQLiteDialect) Upsert(table string, columns []string, keyColumns []string) string {
+	return insertStatement(d, table, columns) +
+		onConflictClause(d, columns, keyColumns)
+}
+
+func (SQLiteDialect) ParseTime(input string) (time.Time, error) {
+	return parseTimeInLayouts(
+		input, "2006-01-02 15:04:05", "2006-01-02T15:04:05",
+		"2006-01-02 15:04:05Z07:00", "2006-01-02")
+}
+
+func (SQLiteDialect) FormatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05.999999999")
+}
+
+func (SQLiteDialect) columnType(column ColumnSchema) string {
+	if column.Type == reflect.TypeOf(time.Time{}) {
+		return "DATETIME"
+	}
+	if column.Type.Kind() == reflect.String {
+		if column.Size > 0 {
+			return fmt.Sprintf("VARCHAR(%d)", column.Size)
+		}
+		return "TEXT"
+	}
+	return "INTEGER"
+}
+
+// CreateTable returns statements creating a table.  An auto-incremented column
+// must be the only primary key column because SQLite supports AUTOINCREMENT
+// only for INTEGER PRIMARY KEY.
+func (d SQLiteDialect) CreateTable(schema *TableSchema) ([]string, error) {
+	primaryKey := schema.PrimaryKey()
+	definitions := []string{}
+	hasAutoIncrement := false
+	for _, column := range schema.Columns {
+		definition := columnDefinition(d, column, d.columnType(column))
+		if column.AutoIncrement {
+			if len(primaryKey) != 1 || primaryKey[0] != column.Name ||
+				d.columnType(column) != "INTEGER" {
+				return nil, errorf(
+					"%s must be the only integer primary key to be auto-incremented "+
+						"in SQLite.", column.Name)
+			}
+			definition += " PRIMARY KEY AUTOINCREMENT"
+			hasAutoIncrement = true
+		}
+		definitions = append(definitions, definition)
+	}
+	if len(primaryKey) > 0 && !hasAutoIncrement {
+		definitions = append(definitions,
+			"PRIMARY KEY ("+joinIdentifiers(d, primaryKey)+")")
+	}
+	return append([]string{fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (\n  %s\n)", d.QuoteIdentifier(schema.Name),
+		strings.Join(definitions, ",\n  "))},
+		indexStatements(d, schema)...), nil
+}
@@ -0,0 +1,91 @@
+package imosql_test
+
+import (
+	imosql "."
+	"testing"
+	"time"
+)
+
+func TestDialect_Upsert(t *testing.T) {
+	testCases := map[imosql.Dialect]string{
+		imosql.MySQLDialect{}: "INSERT INTO `test` (`test_id`, `test_string`) " +
+			"VALUES (?, ?) ON DUPLICATE KEY UPDATE " +
+			"`test_string` = VALUES(`test_string`)",
+		imosql.PostgreSQLDialect{}: `INSERT INTO "test" ("test_id", "test_string") ` +
+			`VALUES ($1, $2) ON CONFLICT ("test_id") DO UPDATE SET ` +
+			`"test_string" = excluded."test_string"`,
+		imosql.SQLiteDialect{}: `INSERT INTO "test" ("test_id", "test_string") ` +
+			`VALUES (?, ?) ON CONFLICT ("test_id") DO UPDATE SET ` +
+			`"test_string" = excluded."test_string"`,
+	}
+	for dialect, expected := range testCases {
+		actual := dialect.Upsert(
+			"test", []string{"test_id", "test_string"}, []string{"test_id"})
+		if actual != expected {
+			t.Errorf("%s: expected: %#v, actual: %#v.", dialect.Name(), expected, actual)
+		}
+	}
+	actual := imosql.PostgreSQLDialect{}.Upsert(
+		"test", []string{"test_id"}, []string{"test_id"})
+	expected := `INSERT INTO "test" ("test_id") VALUES ($1) ` +
+		`ON CONFLICT ("test_id") DO NOTHING`
+	if actual != expected {
+		t.Errorf("expected: %#v, actual: %#v.", expected, actual)
+	}
+	actual = imosql.SQLiteDialect{}.Upsert("test", []string{"test_id"}, nil)
+	expected = `INSERT INTO "test" ("test_id") VALUES (?) ON CONFLICT DO NOTHING`
+	if actual != expected {
+		t.Errorf("expected: %#v, actual: %#v.", expected, actual)
+	}
+}
+
+func TestDialect_QuoteIdentifier(t *testing.T) {
+	if actual := (imosql.MySQLDialect{}).QuoteIdentifier("a`b"); actual != "`a``b`" {
+		t.Errorf("unexpected quoted identifier: %#v.", actual)
+	}
+	if actual := (imosql.PostgreSQLDialect{}).QuoteIdentifier(`a"b`); actual != `"a""b"` {
+		t.Errorf("unexpected quoted identifier: %#v.", actual)
+	}
+}
+
+func TestDialect_ParseTime(t *testing.T) {
+	expected := time.Date(2001, 2, 3, 4, 5, 6, 700000000, time.UTC)
+	testCases := map[imosql.Dialect][]string{
+		imosql.MySQLDialect{}: []string{
+			"2001-02-03 04:05:06.7", "2001-02-03T04:05:06.7Z"},
+		imosql.PostgreSQLDialect{}: []string{
+			"2001-02-03 04:05:06.7", "2001-02-03 13:05:06.7+09",
+			"2001-02-03T04:05:06.7Z"},
+		imosql.SQLiteDialect{}: []string{
+			"2001-02-03 04:05:06.700", "2001-02-03T04:05:06.7",
+			"2001-02-03T04:05:06.7Z"},
+	}
+	for dialect, inputs := range testCases {
+		for _, input := range inputs {
+			actual, err := dialect.ParseTime(input)
+			if err != nil {
+				t.Errorf("%s: failed to parse %#v: %s", dialect.Name(), input, err)
+				continue
+			}
+			if !actual.Equal(expected) {
+				t.Errorf("%s: expected: %v, actual: %v.", dialect.Name(), expected, actual)
+			}
+		}
+		actual, err := dialect.ParseTime(dialect.FormatTime(expected))
+		if err != nil || !actual.Equal(expected) {
+			t.Errorf("%s: FormatTime must be parsed by ParseTime: %v, %v.",
+				dialect.Name(), actual, err)
+		}
+		// DATE values have no time part.
+		actual, err = dialect.ParseTime("2001-02-03")
+		if err != nil || !actual.Equal(time.Date(2001, 2, 3, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("%s: failed to parse a date: %v, %v.", dialect.Name(), actual, err)
+		}
+	}
+	for _, input := range []string{"0000-00-00", "0000-00-00 00:00:00"} {
+		actual, err := imosql.MySQLDialect{}.ParseTime(input)
+		if err != nil || !actual.IsZero() {
+			t.Errorf("%s should be the zero time: %v, %v.", input, actual, err)
+		}
+	}
+}
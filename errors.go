@@ -0,0 +1,196 @@
+package imosql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"reflect"
+)
+
+// Errors returned by Connection wrap errors of drivers, which are classified
+// without importing the drivers by looking at their well-known fields and
+// methods:
+//
+//	github.com/go-sql-driver/mysql  *MySQLError with Number uint16
+//	github.com/lib/pq               *Error with Code string (SQLSTATE)
+//	github.com/jackc/pgx            *PgError with SQLState() string
+//	github.com/mattn/go-sqlite3     Error with Code and ExtendedCode int
+//	modernc.org/sqlite              *Error with Code() int
+
+// causes returns an error and the errors it wraps.
+func causes(err error) []error {
+	result := []error{}
+	for err != nil {
+		result = append(result, err)
+		err = errors.Unwrap(err)
+	}
+	return result
+}
+
+// errorField returns a field of a struct error or a pointer to it.
+func errorField(err error, name string) (reflect.Value, bool) {
+	value := reflect.ValueOf(err)
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return reflect.Value{}, false
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	field := value.FieldByName(name)
+	return field, field.IsValid()
+}
+
+// mysqlErrorNumber returns the error number of a MySQL server error.
+func mysqlErrorNumber(err error) (int, bool) {
+	for _, cause := range causes(err) {
+		field, ok := errorField(cause, "Number")
+		if ok && field.Kind() == reflect.Uint16 {
+			return int(field.Uint()), true
+		}
+	}
+	return 0, false
+}
+
+// sqlState returns the SQLSTATE of a PostgreSQL error.
+func sqlState(err error) (string, bool) {
+	for _, cause := range causes(err) {
+		if stateError, ok := cause.(interface{ SQLState() string }); ok {
+			return stateError.SQLState(), true
+		}
+		field, ok := errorField(cause, "Code")
+		if ok && field.Kind() == reflect.String && len(field.String()) == 5 {
+			return field.String(), true
+		}
+	}
+	return "", false
+}
+
+// sqliteErrorCode returns the extended result code of a SQLite error, whose
+// lowest 8 bits are the primary result code.
+func sqliteErrorCode(err error) (int, bool) {
+	for _, cause := range causes(err) {
+		if codeError, ok := cause.(interface{ Code() int }); ok {
+			return codeError.Code(), true
+		}
+		field, ok := errorField(cause, "Code")
+		if ok && field.Kind() == reflect.Int {
+			code := int(field.Int())
+			// github.com/mattn/go-sqlite3 has the extended result code in
+			// another field.
+			if extended, ok := errorField(cause, "ExtendedCode"); ok &&
+				extended.Kind() == reflect.Int && extended.Int() != 0 {
+				code = int(extended.Int())
+			}
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// IsDuplicateKey returns true iff err is caused by a duplicate value of a
+// primary key or a unique key.
+func IsDuplicateKey(err error) bool {
+	if number, ok := mysqlErrorNumber(err); ok {
+		// ER_DUP_KEY, ER_DUP_ENTRY and ER_DUP_ENTRY_WITH_KEY_NAME.
+		return number == 1022 || number == 1062 || number == 1586
+	}
+	if state, ok := sqlState(err); ok {
+		// unique_violation.
+		return state == "23505"
+	}
+	if code, ok := sqliteErrorCode(err); ok {
+		// SQLITE_CONSTRAINT_PRIMARYKEY and SQLITE_CONSTRAINT_UNIQUE.
+		return code == 1555 || code == 2067
+	}
+	return false
+}
+
+// IsDeadlock returns true iff err is caused by a deadlock, which aborts the
+// transaction.  SQLite has no error for deadlocks, which are reported as
+// SQLITE_BUSY without waiting.
+func IsDeadlock(err error) bool {
+	if number, ok := mysqlErrorNumber(err); ok {
+		// ER_LOCK_DEADLOCK.
+		return number == 1213
+	}
+	if state, ok := sqlState(err); ok {
+		// deadlock_detected.
+		return state == "40P01"
+	}
+	return false
+}
+
+// IsForeignKeyViolation returns true iff err is caused by a foreign key
+// constraint.
+func IsForeignKeyViolation(err error) bool {
+	if number, ok := mysqlErrorNumber(err); ok {
+		// ER_NO_REFERENCED_ROW(_2) and ER_ROW_IS_REFERENCED(_2).
+		return number == 1216 || number == 1217 || number == 1451 || number == 1452
+	}
+	if state, ok := sqlState(err); ok {
+		// foreign_key_violation.
+		return state == "23503"
+	}
+	if code, ok := sqliteErrorCode(err); ok {
+		// SQLITE_CONSTRAINT_FOREIGNKEY.
+		return code == 787
+	}
+	return false
+}
+
+// IsConnectionError returns true iff err is caused by a broken connection
+// (e.g. a server restart or a network failure).  Timeouts and canceled
+// contexts are not connection errors because the server may still be running
+// the query.  ErrInvalidConn of github.com/go-sql-driver/mysql is not
+// classified either because it is a plain error, which cannot be told from
+// other errors without importing the driver.
+func IsConnectionError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var netError net.Error
+	if errors.As(err, &netError) && !netError.Timeout() {
+		return true
+	}
+	if number, ok := mysqlErrorNumber(err); ok {
+		// CR_SERVER_GONE_ERROR, CR_SERVER_LOST and ER_CON_COUNT_ERROR.
+		return number == 2006 || number == 2013 || number == 1040
+	}
+	if state, ok := sqlState(err); ok {
+		// Class 08 is connection exceptions, and 57P01 is admin_shutdown.
+		return state[:2] == "08" || state == "57P01"
+	}
+	return false
+}
+
+// isTransientError returns true iff err is likely to be resolved by retrying:
+// deadlocks, lock wait timeouts, serialization failures and broken
+// connections.
+func isTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if IsDeadlock(err) || IsConnectionError(err) {
+		return true
+	}
+	if number, ok := mysqlErrorNumber(err); ok {
+		// ER_LOCK_WAIT_TIMEOUT.
+		return number == 1205
+	}
+	if state, ok := sqlState(err); ok {
+		// serialization_failure and lock_not_available.
+		return state == "40001" || state == "55P03"
+	}
+	if code, ok := sqliteErrorCode(err); ok {
+		// SQLITE_BUSY and SQLITE_LOCKED.
+		return code&0xff == 5 || code&0xff == 6
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package imosql_test
+
+import (
+	imosql "."
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+// fakePQError has the same field as Error of github.com/lib/pq.
+type fakePQError struct {
+	Code string
+}
+
+func (e *fakePQError) Error() string {
+	return "pq: " + e.Code
+}
+
+// fakePgxError has the same method as PgError of github.com/jackc/pgx.
+type fakePgxError struct {
+	code string
+}
+
+func (e *fakePgxError) Error() string {
+	return "ERROR: " + e.code
+}
+
+func (e *fakePgxError) SQLState() string {
+	return e.code
+}
+
+// fakeSQLiteError has the same fields as Error of github.com/mattn/go-sqlite3.
+type fakeSQLiteError struct {
+	Code         int
+	ExtendedCode int
+}
+
+func (e fakeSQLiteError) Error() string {
+	return fmt.Sprintf("sqlite: %d", e.ExtendedCode)
+}
+
+// fakeTimeoutError is a net.Error reporting a timeout.
+type fakeTimeoutError struct{}
+
+func (fakeTimeoutError) Error() string   { return "i/o timeout" }
+func (fakeTimeoutError) Timeout() bool   { return true }
+func (fakeTimeoutError) Temporary() bool { return true }
+
+func TestErrorClassification(t *testing.T) {
+	const (
+		isDuplicateKey        = "IsDuplicateKey"
+		isDeadlock            = "IsDeadlock"
+		isForeignKeyViolation = "IsForeignKeyViolation"
+		isConnectionError     = "IsConnectionError"
+	)
+	testCases := []struct {
+		err        error
+		classifier string
+	}{
+		{&fakeMySQLError{1062, "Duplicate entry"}, isDuplicateKey},
+		{&fakeMySQLError{1022, "Can't write; duplicate key in table"}, isDuplicateKey},
+		{&fakeMySQLError{1586, "Duplicate entry for key"}, isDuplicateKey},
+		{&fakeMySQLError{1213, "Deadlock found"}, isDeadlock},
+		{&fakeMySQLError{1452, "Cannot add or update a child row"}, isForeignKeyViolation},
+		{&fakeMySQLError{2013, "Lost connection"}, isConnectionError},
+		{&fakeMySQLError{1064, "You have an error in your SQL syntax"}, ""},
+		{&fakePQError{"23505"}, isDuplicateKey},
+		{&fakePQError{"23503"}, isForeignKeyViolation},
+		{&fakePQError{"08006"}, isConnectionError},
+		{&fakePgxError{"40P01"}, isDeadlock},
+		{&fakePgxError{"42601"}, ""},
+		{fakeSQLiteError{19, 2067}, isDuplicateKey},
+		{fakeSQLiteError{19, 787}, isForeignKeyViolation},
+		{fakeSQLiteError{1, 1}, ""},
+		{driver.ErrBadConn, isConnectionError},
+		{&net.OpError{Op: "read", Err: errors.New("connection reset")}, isConnectionError},
+		{&net.OpError{Op: "read", Err: fakeTimeoutError{}}, ""},
+		{context.DeadlineExceeded, ""},
+		{fmt.Errorf("query: %w", context.Canceled), ""},
+		{errors.New("invalid connection"), ""},
+		{errors.New("unknown"), ""},
+		{nil, ""},
+	}
+	classifiers := map[string]func(error) bool{
+		isDuplicateKey:        imosql.IsDuplicateKey,
+		isDeadlock:            imosql.IsDeadlock,
+		isForeignKeyViolation: imosql.IsForeignKeyViolation,
+		isConnectionError:     imosql.IsConnectionError,
+	}
+	for _, testCase := range testCases {
+		for name, classifier := range classifiers {
+			expected := testCase.classifier == name
+			if actual := classifier(testCase.err); actual != expected {
+				t.Errorf("%s(%v): expected: %t, actual: %t.",
+					name, testCase.err, expected, actual)
+			}
+		}
+	}
+}
+
+func TestErrorClassification_Wrapped(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	fake.Expect("INSERT INTO test (test_id) VALUES (1)").
+		ReturnsError(&fakeMySQLError{1062, "Duplicate entry '1' for key 'PRIMARY'"})
+	err := con.Transaction(func(tx *imosql.Connection) error {
+		return tx.Command("INSERT INTO test (test_id) VALUES (1)")
+	})
+	if !imosql.IsDuplicateKey(err) {
+		t.Errorf("IsDuplicateKey should see through imosql's errors: %v", err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
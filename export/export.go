@@ -0,0 +1,280 @@
+// Package export streams the rows of an arbitrary query to an io.Writer in
+// CSV, TSV, JSON Lines or Markdown.  Values are written as text in the same
+// way as imosql parses them into fields:
+//
+//   - NULL is an empty field in CSV, \N in TSV, null in JSON Lines and NULL
+//     in Markdown.
+//   - Binary values (e.g. BLOB columns or invalid UTF-8) are encoded in
+//     base64.
+//   - Time values of DATE, DATETIME and TIMESTAMP columns are parsed with the
+//     dialect of the connection and written in RFC 3339 in UTC.
+package export
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/imos/imosql"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Format is an output format.
+type Format string
+
+const (
+	CSV       Format = "csv"
+	TSV       Format = "tsv"
+	JSONLines Format = "jsonl"
+	Markdown  Format = "markdown"
+)
+
+// ParseFormat returns the Format named name.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case CSV, TSV, JSONLines, Markdown:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown format: %s.", name)
+}
+
+// rowWriter writes rows in a format.  A nil value represents NULL.
+type rowWriter interface {
+	WriteHeader(columns []string) error
+	WriteRow(values []*string) error
+	Flush() error
+}
+
+func newRowWriter(w io.Writer, format Format) (rowWriter, error) {
+	switch format {
+	case CSV:
+		return &csvWriter{writer: csv.NewWriter(w)}, nil
+	case TSV:
+		return &tsvWriter{writer: w}, nil
+	case JSONLines:
+		return &jsonLinesWriter{encoder: json.NewEncoder(w)}, nil
+	case Markdown:
+		return &markdownWriter{writer: w}, nil
+	}
+	return nil, fmt.Errorf("unknown format: %s.", format)
+}
+
+// Export runs a query and writes its rows with a header to w in a format.
+// Rows are streamed, so a large result does not need to fit in memory.
+// Export returns the number of rows written.
+func Export(con *imosql.Connection, w io.Writer, format Format, query string, args ...interface{}) (int, error) {
+	writer, err := newRowWriter(w, format)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := con.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get columns: %s", err)
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get column types: %s", err)
+	}
+	if err := writer.WriteHeader(columns); err != nil {
+		return 0, err
+	}
+	fields := make([]sql.RawBytes, len(columns))
+	interfaceFields := make([]interface{}, len(fields))
+	for index := range fields {
+		interfaceFields[index] = &fields[index]
+	}
+	values := make([]*string, len(columns))
+	numRows := 0
+	for rows.Next() {
+		if err := rows.Scan(interfaceFields...); err != nil {
+			return numRows, fmt.Errorf("failed to read rows: %s", err)
+		}
+		for index, field := range fields {
+			values[index] = formatValue(
+				con.Dialect(), columnTypes[index].DatabaseTypeName(), field)
+		}
+		if err := writer.WriteRow(values); err != nil {
+			return numRows, err
+		}
+		numRows++
+	}
+	if err := rows.Err(); err != nil {
+		return numRows, fmt.Errorf("failed to read rows: %s", err)
+	}
+	return numRows, writer.Flush()
+}
+
+// formatValue formats a value of a column with a database type name.  It
+// returns nil for NULL.
+func formatValue(dialect imosql.Dialect, typeName string, value sql.RawBytes) *string {
+	if value == nil {
+		return nil
+	}
+	typeName = strings.ToUpper(typeName)
+	result := string(value)
+	switch {
+	case strings.Contains(typeName, "BLOB") || strings.Contains(typeName, "BINARY") ||
+		typeName == "BYTEA" || !utf8.Valid(value):
+		result = base64.StdEncoding.EncodeToString(value)
+	case typeName == "DATE" || typeName == "DATETIME" ||
+		strings.HasPrefix(typeName, "TIMESTAMP"):
+		if t, err := dialect.ParseTime(result); err == nil {
+			result = t.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return &result
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Formats
+////////////////////////////////////////////////////////////////////////////////
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvWriter) WriteHeader(columns []string) error {
+	return w.writer.Write(columns)
+}
+
+func (w *csvWriter) WriteRow(values []*string) error {
+	record := make([]string, len(values))
+	for index, value := range values {
+		if value != nil {
+			record[index] = *value
+		}
+	}
+	return w.writer.Write(record)
+}
+
+func (w *csvWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// tsvWriter escapes values in the same way as MySQL's SELECT ... INTO OUTFILE
+// so that the output can be loaded by LOAD DATA INFILE.
+type tsvWriter struct {
+	writer io.Writer
+}
+
+var tsvEscaper = strings.NewReplacer(
+	`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`, "\x00", `\0`)
+
+func (w *tsvWriter) writeLine(values []*string) error {
+	fields := make([]string, len(values))
+	for index, value := range values {
+		if value == nil {
+			fields[index] = `\N`
+		} else {
+			fields[index] = tsvEscaper.Replace(*value)
+		}
+	}
+	_, err := io.WriteString(w.writer, strings.Join(fields, "\t")+"\n")
+	return err
+}
+
+func (w *tsvWriter) WriteHeader(columns []string) error {
+	values := make([]*string, len(columns))
+	for index := range columns {
+		values[index] = &columns[index]
+	}
+	return w.writeLine(values)
+}
+
+func (w *tsvWriter) WriteRow(values []*string) error {
+	return w.writeLine(values)
+}
+
+func (w *tsvWriter) Flush() error {
+	return nil
+}
+
+// jsonLinesWriter writes every row as a JSON object whose keys are in the
+// order of the columns.  Values are strings or null.
+type jsonLinesWriter struct {
+	encoder *json.Encoder
+	columns []string
+}
+
+func (w *jsonLinesWriter) WriteHeader(columns []string) error {
+	w.columns = columns
+	return nil
+}
+
+func (w *jsonLinesWriter) WriteRow(values []*string) error {
+	object := json.RawMessage{'{'}
+	for index, value := range values {
+		if index > 0 {
+			object = append(object, ',')
+		}
+		key, err := json.Marshal(w.columns[index])
+		if err != nil {
+			return err
+		}
+		encodedValue, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		object = append(object, key...)
+		object = append(object, ':')
+		object = append(object, encodedValue...)
+	}
+	object = append(object, '}')
+	return w.encoder.Encode(object)
+}
+
+func (w *jsonLinesWriter) Flush() error {
+	return nil
+}
+
+// markdownWriter writes a GitHub Flavored Markdown table.
+type markdownWriter struct {
+	writer io.Writer
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "|", `\|`, "\r\n", "<br>", "\n", "<br>")
+
+func (w *markdownWriter) writeLine(cells []string) error {
+	_, err := io.WriteString(w.writer, "| "+strings.Join(cells, " | ")+" |\n")
+	return err
+}
+
+func (w *markdownWriter) WriteHeader(columns []string) error {
+	cells := make([]string, len(columns))
+	separators := make([]string, len(columns))
+	for index, column := range columns {
+		cells[index] = markdownEscaper.Replace(column)
+		separators[index] = "---"
+	}
+	if err := w.writeLine(cells); err != nil {
+		return err
+	}
+	return w.writeLine(separators)
+}
+
+func (w *markdownWriter) WriteRow(values []*string) error {
+	cells := make([]string, len(values))
+	for index, value := range values {
+		if value == nil {
+			cells[index] = "NULL"
+		} else {
+			cells[index] = markdownEscaper.Replace(*value)
+		}
+	}
+	return w.writeLine(cells)
+}
+
+func (w *markdownWriter) Flush() error {
+	return nil
+}
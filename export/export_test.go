@@ -0,0 +1,72 @@
+package export
+
+import (
+	"bytes"
+	"github.com/imos/imosql"
+	"github.com/imos/imosql/imosqltest/fakedb"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	testCases := map[Format]string{
+		CSV: "id,name,created,data\n" +
+			"1,\"a,\"\"b\"\"\",2000-01-02T03:04:05Z,AP8=\n" +
+			"2,,,\n",
+		TSV: "id\tname\tcreated\tdata\n" +
+			"1\ta,\"b\"\t2000-01-02T03:04:05Z\tAP8=\n" +
+			"2\t\\N\t\\N\t\\N\n",
+		JSONLines: `{"id":"1","name":"a,\"b\"","created":"2000-01-02T03:04:05Z","data":"AP8="}` + "\n" +
+			`{"id":"2","name":null,"created":null,"data":null}` + "\n",
+		Markdown: "| id | name | created | data |\n" +
+			"| --- | --- | --- | --- |\n" +
+			"| 1 | a,\"b\" | 2000-01-02T03:04:05Z | AP8= |\n" +
+			"| 2 | NULL | NULL | NULL |\n",
+	}
+	for format, expected := range testCases {
+		con, fake := fakedb.Open(t)
+		fake.Expect("SELECT * FROM test WHERE id IN (?, ?)", 1, 2).
+			Returns(
+				[]string{"id", "name", "created", "data"},
+				[]interface{}{1, `a,"b"`, "2000-01-02 03:04:05", []byte{0, 255}},
+				[]interface{}{2, nil, nil, nil}).
+			ReturnsColumnTypes("BIGINT", "VARCHAR", "DATETIME", "BLOB")
+		output := &bytes.Buffer{}
+		numRows, err := Export(
+			con, output, format, "SELECT * FROM test WHERE id IN (?)",
+			imosql.In([]int{1, 2}))
+		if err != nil {
+			t.Errorf("%s: failed to export: %s", format, err)
+			continue
+		}
+		if numRows != 2 {
+			t.Errorf("%s: unexpected # of rows: %d.", format, numRows)
+		}
+		if output.String() != expected {
+			t.Errorf("%s: unexpected output:\n%s", format, output.String())
+		}
+		if err := fake.Check(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestTSVEscape(t *testing.T) {
+	output := &bytes.Buffer{}
+	value := "a\tb\nc\\d"
+	writer := &tsvWriter{writer: output}
+	if err := writer.WriteRow([]*string{&value, nil}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "a\\tb\\nc\\\\d\t\\N\n"; output.String() != expected {
+		t.Errorf("expected: %q, actual: %q.", expected, output.String())
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if format, err := ParseFormat("JSONL"); err != nil || format != JSONLines {
+		t.Errorf("unexpected result: %s, %v.", format, err)
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Errorf("ParseFormat should fail for an unknown format.")
+	}
+}
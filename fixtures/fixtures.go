@@ -0,0 +1,259 @@
+// Package fixtures loads rows of multiple tables from YAML or JSON files into
+// a database for tests.  A fixture file is a list of tables with their rows:
+//
+//	# A fixture of users and their posts.
+//	- table: users
+//	  rows:
+//	    - {user_id: 1, user_name: foo}
+//	- table: posts
+//	  depends_on: [users]
+//	  rows:
+//	    - {post_id: 1, user_id: 1, post_body: "Hello."}
+//
+// Loader.Load empties the tables in reverse dependency order and inserts the
+// rows in dependency order in a single transaction.  Tables are emptied by
+// DELETE instead of TRUNCATE because TRUNCATE cannot be rolled back in MySQL.
+package fixtures
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/imos/imosql"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Table is rows of a table in a fixture file.
+type Table struct {
+	// Name is the name of the table.
+	Name string `json:"table" yaml:"table"`
+	// DependsOn is tables which must be filled before the table (e.g. tables
+	// referred by foreign keys of the table).
+	DependsOn []string `json:"depends_on" yaml:"depends_on"`
+	// Rows maps column names to values for every row.
+	Rows []map[string]interface{} `json:"rows" yaml:"rows"`
+}
+
+// Loader loads fixtures into a database.
+type Loader struct {
+	tables   []*Table
+	rowTypes map[string]reflect.Type
+}
+
+// NewLoader creates a Loader with no fixtures.
+func NewLoader() *Loader {
+	return &Loader{rowTypes: map[string]reflect.Type{}}
+}
+
+// RegisterRow registers a row struct with sql tags for a table.  Rows of the
+// table are validated and converted with the struct: every column must have
+// a corresponding field, and every value is parsed in the same way as
+// imosql.RowReader does, so that e.g. time values can be written as strings.
+func (l *Loader) RegisterRow(table string, row interface{}) error {
+	rowType := reflect.TypeOf(row)
+	for rowType != nil && rowType.Kind() == reflect.Ptr {
+		rowType = rowType.Elem()
+	}
+	if rowType == nil || rowType.Kind() != reflect.Struct {
+		return fmt.Errorf("row must be a struct but %T.", row)
+	}
+	l.rowTypes[table] = rowType
+	return nil
+}
+
+// Add adds tables to the Loader.  Rows of a table which has already been
+// added are appended to the existing ones.
+func (l *Loader) Add(tables ...Table) {
+	for tableIndex := range tables {
+		table := tables[tableIndex]
+		existingTable := l.table(table.Name)
+		if existingTable == nil {
+			l.tables = append(l.tables, &table)
+			continue
+		}
+		existingTable.DependsOn = append(existingTable.DependsOn, table.DependsOn...)
+		existingTable.Rows = append(existingTable.Rows, table.Rows...)
+	}
+}
+
+func (l *Loader) table(name string) *Table {
+	for _, table := range l.tables {
+		if table.Name == name {
+			return table
+		}
+	}
+	return nil
+}
+
+// AddFile adds tables in a fixture file, which must be JSON if its extension
+// is .json and YAML otherwise.
+func (l *Loader) AddFile(path string) error {
+	input, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read a fixture file: %s", err)
+	}
+	tables := []Table{}
+	if filepath.Ext(path) == ".json" {
+		err = ParseJSON(input, &tables)
+	} else {
+		err = ParseYAML(input, &tables)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %s", path, err)
+	}
+	l.Add(tables...)
+	return nil
+}
+
+// ParseJSON parses tables in JSON.  Numbers are kept as strings so that
+// large integers do not lose their precision.
+func ParseJSON(input []byte, tables *[]Table) error {
+	decoder := json.NewDecoder(bytes.NewReader(input))
+	decoder.UseNumber()
+	return decoder.Decode(tables)
+}
+
+// ParseYAML parses tables in YAML.
+func ParseYAML(input []byte, tables *[]Table) error {
+	return yaml.Unmarshal(input, tables)
+}
+
+// sortedTables returns tables in dependency order.  Tables which do not
+// depend on each other keep the order they are added.
+func (l *Loader) sortedTables() ([]*Table, error) {
+	result := []*Table{}
+	states := map[string]int{}
+	const visiting, visited = 1, 2
+	var visit func(table *Table) error
+	visit = func(table *Table) error {
+		switch states[table.Name] {
+		case visiting:
+			return fmt.Errorf("circular dependency at %s.", table.Name)
+		case visited:
+			return nil
+		}
+		states[table.Name] = visiting
+		for _, name := range table.DependsOn {
+			// Tables without fixtures need not be filled.
+			if dependency := l.table(name); dependency != nil {
+				if err := visit(dependency); err != nil {
+					return err
+				}
+			}
+		}
+		states[table.Name] = visited
+		result = append(result, table)
+		return nil
+	}
+	for _, table := range l.tables {
+		if err := visit(table); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// convertRow converts a row with a registered row struct.
+func (l *Loader) convertRow(con *imosql.Connection, table string, row map[string]interface{}) (map[string]interface{}, error) {
+	rowType, ok := l.rowTypes[table]
+	if !ok {
+		return row, nil
+	}
+	columnToFieldIndex := map[string]int{}
+	for fieldIndex := 0; fieldIndex < rowType.NumField(); fieldIndex++ {
+		columnToFieldIndex[imosql.ColumnName(rowType.Field(fieldIndex))] = fieldIndex
+	}
+	columns := []string{}
+	for column := range row {
+		if _, ok := columnToFieldIndex[column]; !ok {
+			return nil, fmt.Errorf("unknown column: %s.", column)
+		}
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	fields := make([]sql.NullString, len(columns))
+	for index, column := range columns {
+		if row[column] != nil {
+			fields[index] = sql.NullString{
+				String: formatValue(con.Dialect(), row[column]), Valid: true}
+		}
+	}
+	rowsPtr := reflect.New(reflect.SliceOf(rowType))
+	rowReader, err := imosql.NewRowReader(rowsPtr.Interface())
+	if err != nil {
+		return nil, err
+	}
+	if err := rowReader.SetColumns(columns); err != nil {
+		return nil, err
+	}
+	rowReader.SetDialect(con.Dialect())
+	parsedRow, err := rowReader.ParseFields(fields)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{}
+	for index, column := range columns {
+		if fields[index].Valid {
+			result[column] = parsedRow.Elem().Field(columnToFieldIndex[column]).Interface()
+		} else {
+			result[column] = nil
+		}
+	}
+	return result, nil
+}
+
+// formatValue formats a value in a fixture file as a value returned by a
+// server.
+func formatValue(dialect imosql.Dialect, value interface{}) string {
+	switch value := value.(type) {
+	case bool:
+		if value {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return dialect.FormatTime(value)
+	}
+	return fmt.Sprint(value)
+}
+
+// Load empties the tables of the fixtures and inserts their rows in a
+// transaction.  If con is already in a transaction, Load uses it.
+func (l *Loader) Load(con *imosql.Connection) error {
+	tables, err := l.sortedTables()
+	if err != nil {
+		return err
+	}
+	load := func(tx *imosql.Connection) error {
+		for tableIndex := len(tables) - 1; tableIndex >= 0; tableIndex-- {
+			table := tables[tableIndex]
+			if err := tx.Command(
+				"DELETE FROM " + tx.Dialect().QuoteIdentifier(table.Name)); err != nil {
+				return fmt.Errorf("failed to empty %s: %w", table.Name, err)
+			}
+		}
+		for _, table := range tables {
+			for rowIndex, row := range table.Rows {
+				row, err := l.convertRow(tx, table.Name, row)
+				if err == nil {
+					_, err = tx.Insert(table.Name, row)
+				}
+				if err != nil {
+					return fmt.Errorf(
+						"failed to insert row #%d into %s: %w", rowIndex, table.Name, err)
+				}
+			}
+		}
+		return nil
+	}
+	if con.InTransaction() {
+		return load(con)
+	}
+	return con.Transaction(load)
+}
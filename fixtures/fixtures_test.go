@@ -0,0 +1,77 @@
+package fixtures_test
+
+import (
+	"github.com/imos/imosql"
+	"github.com/imos/imosql/fixtures"
+	"github.com/imos/imosql/imosqltest"
+	"github.com/imos/imosql/imosqltest/fakedb"
+	"testing"
+	"time"
+)
+
+type User struct {
+	Id    int64  `sql:"user_id"`
+	Name  string `sql:"user_name"`
+	Admin bool   `sql:"user_admin"`
+}
+
+type Post struct {
+	Id     int64     `sql:"post_id"`
+	UserId int64     `sql:"user_id"`
+	Time   time.Time `sql:"post_time"`
+}
+
+func TestLoader(t *testing.T) {
+	con, fake := fakedb.Open(t)
+	fake.Expect("DELETE FROM `posts`")
+	fake.Expect("DELETE FROM `users`")
+	fake.Expect(
+		"INSERT INTO `users` (`user_admin`, `user_id`, `user_name`) "+
+			"VALUES (?, ?, ?)", true, 1, "foo")
+	fake.Expect(
+		"INSERT INTO `users` (`user_admin`, `user_id`, `user_name`) "+
+			"VALUES (?, ?, ?)", false, 2, "bar")
+	fake.Expect(
+		"INSERT INTO `users` (`user_id`, `user_name`) VALUES (?, ?)",
+		"12345678901234567", nil)
+	fake.Expect(
+		"INSERT INTO `posts` (`post_id`, `post_time`, `user_id`) "+
+			"VALUES (?, ?, ?)",
+		1, time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC), 1)
+	loader := fixtures.NewLoader()
+	loader.RegisterRow("posts", Post{})
+	if err := loader.AddFile("testdata/fixtures.yaml"); err != nil {
+		t.Fatalf("failed to add a file: %s", err)
+	}
+	if err := loader.AddFile("testdata/fixtures.json"); err != nil {
+		t.Fatalf("failed to add a file: %s", err)
+	}
+	if err := loader.Load(con); err != nil {
+		t.Fatalf("failed to load: %s", err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoader_Error(t *testing.T) {
+	con, err := imosql.Open(
+		imosqltest.DriverName, imosqltest.NewDatabase().DataSourceName())
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+	loader := fixtures.NewLoader()
+	loader.Add(
+		fixtures.Table{Name: "a", DependsOn: []string{"b"}},
+		fixtures.Table{Name: "b", DependsOn: []string{"a"}})
+	if err := loader.Load(con); err == nil {
+		t.Errorf("Load should fail for circular dependencies.")
+	}
+	loader = fixtures.NewLoader()
+	loader.RegisterRow("users", User{})
+	loader.Add(fixtures.Table{
+		Name: "users", Rows: []map[string]interface{}{{"unknown": 1}}})
+	if err := loader.Load(con); err == nil {
+		t.Errorf("Load should fail for unknown columns.")
+	}
+}
@@ -0,0 +1,180 @@
+package imosql
+
+import (
+	"context"
+	"time"
+)
+
+// defaultHealthCheckTimeout is the timeout of a health check of a replica if
+// ReplicaHealthCheck.Interval is zero.
+const defaultHealthCheckTimeout = 10 * time.Second
+
+// ReplicaHealthCheck configures health checking of replicas.
+type ReplicaHealthCheck struct {
+	// Interval is the interval of periodic checks.  Zero disables periodic
+	// checks, and replicas are checked only by Connection.CheckReplicas.  A
+	// check of a replica times out after Interval (or 10 seconds if Interval
+	// is zero), so that a hung replica cannot block health checks.
+	Interval time.Duration
+	// HeartbeatQuery returns the time of the latest heartbeat written into
+	// the primary (e.g. "SELECT ts FROM heartbeat" with pt-heartbeat), which
+	// is used to measure replication lag.  Lag is not measured if it is
+	// empty.
+	HeartbeatQuery string
+	// MaxLag is the maximum replication lag of a healthy replica.  Zero means
+	// unlimited.
+	MaxLag time.Duration
+}
+
+// ReplicaState is the state of a replica found by the last health check.
+type ReplicaState struct {
+	// Name is the host and the database name of the replica (see
+	// RedactDataSourceName).
+	Name string
+	// Healthy is false if the replica is ejected from routing, which is
+	// true until the replica is checked.
+	Healthy bool
+	// Lag is the replication lag, which is zero if it is not measured.
+	Lag       time.Duration
+	LastCheck time.Time
+	// Err is the reason why the replica is unhealthy.
+	Err error
+}
+
+// SetReplicaHealthCheck sets how to check replicas, and starts checking them
+// periodically in background if check.Interval is positive.  Unhealthy
+// replicas (i.e. replicas failing to respond or lagging by more than
+// check.MaxLag) are ejected from routing until they become healthy.  If no
+// replicas are healthy, queries run on the primary.  Periodic checks stop
+// when the health check is set again or the Connection is closed.
+func (c *Connection) SetReplicaHealthCheck(check ReplicaHealthCheck) {
+	set := c.replicaSet()
+	set.stopHealthChecks()
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	set.healthCheck = check
+	if check.Interval > 0 {
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		set.stopHealthCheck = stop
+		set.healthCheckDone = done
+		go func() {
+			defer close(done)
+			ticker := time.NewTicker(check.Interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					c.CheckReplicas()
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// stopHealthChecks stops periodic health checks and waits for the running
+// check to finish.
+func (set *replicaSet) stopHealthChecks() {
+	set.mutex.Lock()
+	stop, done := set.stopHealthCheck, set.healthCheckDone
+	set.stopHealthCheck, set.healthCheckDone = nil, nil
+	set.mutex.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// CheckReplicas checks the health of every replica now.
+func (c *Connection) CheckReplicas() {
+	set := c.replicaSet()
+	set.mutex.Lock()
+	replicas := set.replicas
+	check := set.healthCheck
+	set.mutex.Unlock()
+	for _, replica := range replicas {
+		state := c.checkReplica(replica, check)
+		set.mutex.Lock()
+		if replica.state.Healthy != state.Healthy {
+			if state.Healthy {
+				printLogf("replica %s is back.", replica.name)
+			} else {
+				printLogf("replica %s is ejected: %s", replica.name, state.Err)
+			}
+		}
+		replica.state = state
+		set.mutex.Unlock()
+	}
+}
+
+func (c *Connection) checkReplica(replica *replica, check ReplicaHealthCheck) ReplicaState {
+	state := ReplicaState{Name: replica.name, LastCheck: time.Now()}
+	timeout := check.Interval
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := replica.db.PingContext(ctx); err != nil {
+		state.Err = errorf("failed to ping: %s", err)
+		return state
+	}
+	if check.HeartbeatQuery != "" {
+		var heartbeat interface{}
+		if err := replica.db.QueryRowContext(
+			ctx, check.HeartbeatQuery).Scan(&heartbeat); err != nil {
+			state.Err = errorf("failed to read a heartbeat: %s", err)
+			return state
+		}
+		heartbeatTime, err := c.parseHeartbeat(heartbeat)
+		if err != nil {
+			state.Err = errorf("failed to parse a heartbeat: %s", err)
+			return state
+		}
+		now, err := c.Now()
+		if err != nil {
+			state.Err = errorf("failed to get the current time: %s", err)
+			return state
+		}
+		if now.After(heartbeatTime) {
+			state.Lag = now.Sub(heartbeatTime)
+		}
+		if check.MaxLag > 0 && state.Lag > check.MaxLag {
+			state.Err = errorf("replication lag %s exceeds %s.", state.Lag, check.MaxLag)
+			return state
+		}
+	}
+	state.Healthy = true
+	return state
+}
+
+// parseHeartbeat converts a heartbeat into time.Time.  Drivers return it as
+// time.Time (e.g. MySQL with parseTime=true and PostgreSQL) or as a string.
+func (c *Connection) parseHeartbeat(heartbeat interface{}) (time.Time, error) {
+	switch value := heartbeat.(type) {
+	case time.Time:
+		return value, nil
+	case []byte:
+		return c.Dialect().ParseTime(string(value))
+	case string:
+		return c.Dialect().ParseTime(value)
+	case nil:
+		return time.Time{}, errorf("heartbeat is NULL.")
+	}
+	return time.Time{}, errorf("unsupported heartbeat type: %T", heartbeat)
+}
+
+// ReplicaStates returns the states of the replicas in the order they are
+// added.
+func (c *Connection) ReplicaStates() []ReplicaState {
+	set := c.replicaSet()
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	states := make([]ReplicaState, len(set.replicas))
+	for index, replica := range set.replicas {
+		states[index] = replica.state
+	}
+	return states
+}
@@ -0,0 +1,108 @@
+package imosql_test
+
+import (
+	imosql "."
+	"errors"
+	"github.com/imos/imosql/imosqltest"
+	"testing"
+	"time"
+)
+
+func TestConnection_CheckReplicas(t *testing.T) {
+	con, primary := openFakeDatabase(t)
+	replicas := []*imosqltest.Database{
+		addFakeReplica(t, con), addFakeReplica(t, con), addFakeReplica(t, con)}
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	con.SetClock(imosql.NewManualClock(now))
+	con.SetReplicaHealthCheck(imosql.ReplicaHealthCheck{
+		HeartbeatQuery: "SELECT ts FROM heartbeat",
+		MaxLag:         10 * time.Second,
+	})
+	heartbeat := []string{"ts"}
+	replicas[0].Expect("SELECT ts FROM heartbeat").
+		Returns(heartbeat, []interface{}{"1999-12-31 23:59:58"})
+	replicas[1].Expect("SELECT ts FROM heartbeat").
+		Returns(heartbeat, []interface{}{"1999-12-31 23:59:00"})
+	replicas[2].Expect("SELECT ts FROM heartbeat").
+		ReturnsError(errors.New("table heartbeat doesn't exist"))
+	con.CheckReplicas()
+	states := con.ReplicaStates()
+	if len(states) != 3 {
+		t.Fatalf("unexpected states: %#v.", states)
+	}
+	if !states[0].Healthy || states[0].Lag != 2*time.Second {
+		t.Errorf("replica #0 should be healthy: %#v.", states[0])
+	}
+	if states[1].Healthy || states[1].Lag != time.Minute || states[1].Err == nil {
+		t.Errorf("replica #1 should lag: %#v.", states[1])
+	}
+	if states[2].Healthy || states[2].Err == nil {
+		t.Errorf("replica #2 should be unhealthy: %#v.", states[2])
+	}
+	replicas[0].Expect("SELECT 1").Returns([]string{"1"}, []interface{}{1})
+	replicas[0].Expect("SELECT 2").Returns([]string{"2"}, []interface{}{2})
+	con.IntegerOrDie("SELECT 1")
+	con.IntegerOrDie("SELECT 2")
+
+	// Queries run on the primary if no replicas are healthy.
+	replicas[0].Expect("SELECT ts FROM heartbeat").
+		Returns(heartbeat, []interface{}{"1999-12-31 23:00:00"})
+	replicas[1].Expect("SELECT ts FROM heartbeat").
+		Returns(heartbeat, []interface{}{"1999-12-31 23:00:00"})
+	replicas[2].Expect("SELECT ts FROM heartbeat").
+		Returns(heartbeat, []interface{}{"1999-12-31 23:00:00"})
+	primary.Expect("SELECT 3").Returns([]string{"3"}, []interface{}{3})
+	con.CheckReplicas()
+	con.IntegerOrDie("SELECT 3")
+	for _, fake := range append(replicas, primary) {
+		if err := fake.Check(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestConnection_PeriodicReplicaHealthCheck(t *testing.T) {
+	con, _ := openFakeDatabase(t)
+	replica := addFakeReplica(t, con)
+	replica.Expect("SELECT 0").ReturnsError(errors.New("replica is stopped"))
+	con.SetReplicaHealthCheck(imosql.ReplicaHealthCheck{
+		Interval: time.Millisecond, HeartbeatQuery: "SELECT 0"})
+	defer con.Close()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if !con.ReplicaStates()[0].Healthy {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Errorf("the replica should be ejected by a periodic check.")
+}
+
+func TestConnection_CheckReplicasWithTimeHeartbeat(t *testing.T) {
+	con, _ := openFakeDatabase(t)
+	replica := addFakeReplica(t, con)
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	con.SetClock(imosql.NewManualClock(now))
+	con.SetReplicaHealthCheck(imosql.ReplicaHealthCheck{
+		HeartbeatQuery: "SELECT ts FROM heartbeat"})
+	replica.Expect("SELECT ts FROM heartbeat").Returns(
+		[]string{"ts"}, []interface{}{now.Add(-3 * time.Second)})
+	con.CheckReplicas()
+	if state := con.ReplicaStates()[0]; !state.Healthy || state.Lag != 3*time.Second {
+		t.Errorf("the replica should be healthy: %#v.", state)
+	}
+	if err := replica.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnection_CloseReplicas(t *testing.T) {
+	con, _ := openFakeDatabase(t)
+	addFakeReplica(t, con)
+	con.SetReplicaHealthCheck(imosql.ReplicaHealthCheck{Interval: time.Millisecond})
+	if err := con.Close(); err != nil {
+		t.Fatalf("failed to close the database: %s", err)
+	}
+	if states := con.ReplicaStates(); len(states) != 0 {
+		t.Errorf("replicas should be closed: %#v.", states)
+	}
+}
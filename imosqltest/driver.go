@@ -0,0 +1,121 @@
+package imosqltest
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io"
+)
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	registry.Lock()
+	defer registry.Unlock()
+	database, ok := registry.databases[name]
+	if !ok {
+		return nil, fmt.Errorf("imosqltest: unknown data source name: %s", name)
+	}
+	return &fakeConn{database: database}, nil
+}
+
+type fakeConn struct {
+	database *Database
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error {
+	return nil
+}
+
+func (fakeTx) Rollback() error {
+	return nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	e, err := s.conn.database.consume(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return fakeResult{e}, nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	e, err := s.conn.database.consume(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &fakeRows{expectation: e}, nil
+}
+
+type fakeResult struct {
+	expectation *Expectation
+}
+
+func (r fakeResult) LastInsertId() (int64, error) {
+	return r.expectation.lastInsertId, nil
+}
+
+func (r fakeResult) RowsAffected() (int64, error) {
+	return r.expectation.rowsAffected, nil
+}
+
+type fakeRows struct {
+	expectation *Expectation
+	rowIndex    int
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.expectation.columns
+}
+
+func (r *fakeRows) ColumnTypeDatabaseTypeName(index int) string {
+	if index < len(r.expectation.columnTypes) {
+		return r.expectation.columnTypes[index]
+	}
+	return ""
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.rowIndex >= len(r.expectation.rows) {
+		return io.EOF
+	}
+	copy(dest, r.expectation.rows[r.rowIndex])
+	r.rowIndex++
+	return nil
+}
@@ -0,0 +1,21 @@
+// Package fakedb opens Connections to fake databases of imosqltest for unit
+// tests.  It is separated from imosqltest so that imosqltest does not depend
+// on ImoSQL, whose own tests use imosqltest.
+package fakedb
+
+import (
+	"github.com/imos/imosql"
+	"github.com/imos/imosql/imosqltest"
+)
+
+// Open creates an imosqltest.Database with no expectations and a Connection
+// to it.  It fails the test if the Connection cannot be opened.
+func Open(t imosql.TestingT) (*imosql.Connection, *imosqltest.Database) {
+	t.Helper()
+	fake := imosqltest.NewDatabase()
+	con, err := imosql.Open(imosqltest.DriverName, fake.DataSourceName())
+	if err != nil {
+		t.Fatalf("fakedb: failed to open a fake database: %s", err)
+	}
+	return con, fake
+}
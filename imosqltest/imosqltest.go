@@ -0,0 +1,195 @@
+// Package imosqltest provides an in-memory database/sql driver for unit tests
+// of code built on ImoSQL.  A test registers the queries it expects with
+// canned results, and the driver serves them in order without any SQL server:
+//
+//	fake := imosqltest.NewDatabase()
+//	fake.Expect("SELECT * FROM test WHERE test_id = ?", 1).Returns(
+//		[]string{"test_id", "test_string"}, []interface{}{1, "foo"})
+//	con, err := imosql.Open(imosqltest.DriverName, fake.DataSourceName())
+//	...
+//	if err := fake.Check(); err != nil {
+//		t.Error(err)
+//	}
+//
+// Open in package github.com/imos/imosql/imosqltest/fakedb creates a Database
+// and opens a Connection to it in one call.
+package imosqltest
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// DriverName is the name of the driver registered to database/sql.
+const DriverName = "imosqltest"
+
+var registry = struct {
+	sync.Mutex
+	databases map[string]*Database
+	count     int
+}{databases: map[string]*Database{}}
+
+func init() {
+	sql.Register(DriverName, fakeDriver{})
+}
+
+// Database is a fake database serving canned results for expected queries.
+// Every Database has its own data source name, so tests using different
+// Databases can run in parallel.
+type Database struct {
+	mutex          sync.Mutex
+	dataSourceName string
+	expectations   []*Expectation
+	numConsumed    int
+}
+
+// Expectation is a query expected to be run against a Database with its
+// canned result.
+type Expectation struct {
+	query        string
+	args         []driver.Value
+	checksArgs   bool
+	columns      []string
+	columnTypes  []string
+	rows         [][]driver.Value
+	lastInsertId int64
+	rowsAffected int64
+	err          error
+}
+
+// NewDatabase creates a Database with no expectations.
+func NewDatabase() *Database {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.count++
+	d := &Database{dataSourceName: fmt.Sprintf("imosqltest-%d", registry.count)}
+	registry.databases[d.dataSourceName] = d
+	return d
+}
+
+// DataSourceName returns a data source name to open the Database with
+// DriverName.
+func (d *Database) DataSourceName() string {
+	return d.dataSourceName
+}
+
+// Expect registers a query expected to be run next to the previously
+// registered ones.  Queries are compared ignoring differences in whitespace.
+// If args are given, arguments of the query must be equal to them after
+// database/sql's default conversion (e.g. int is converted into int64).
+// Without args, arguments of the query are not checked.  The expected query
+// returns no rows and no errors unless its result is specified.
+func (d *Database) Expect(query string, args ...interface{}) *Expectation {
+	e := &Expectation{query: normalizeQuery(query), checksArgs: len(args) > 0}
+	for _, arg := range args {
+		value, err := driver.DefaultParameterConverter.ConvertValue(arg)
+		if err != nil {
+			panic(fmt.Sprintf("imosqltest: invalid argument %#v: %s", arg, err))
+		}
+		e.args = append(e.args, value)
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.expectations = append(d.expectations, e)
+	return e
+}
+
+// Returns sets columns and rows returned by the expected query.  Every row
+// must have as many values as columns, and nil represents NULL.
+func (e *Expectation) Returns(columns []string, rows ...[]interface{}) *Expectation {
+	e.columns = columns
+	e.rows = nil
+	for _, row := range rows {
+		if len(row) != len(columns) {
+			panic(fmt.Sprintf(
+				"imosqltest: # of values must be %d but %d.", len(columns), len(row)))
+		}
+		values := make([]driver.Value, len(row))
+		for index, value := range row {
+			var err error
+			if values[index], err = convertResultValue(value); err != nil {
+				panic(fmt.Sprintf("imosqltest: invalid value %#v: %s", value, err))
+			}
+		}
+		e.rows = append(e.rows, values)
+	}
+	return e
+}
+
+// ReturnsColumnTypes sets database type names of the columns returned by the
+// expected query (e.g. "VARCHAR"), which are available via
+// sql.ColumnType.DatabaseTypeName.  Every column has an empty type name
+// unless this is called.
+func (e *Expectation) ReturnsColumnTypes(columnTypes ...string) *Expectation {
+	e.columnTypes = columnTypes
+	return e
+}
+
+// ReturnsResult sets the result of the expected command.
+func (e *Expectation) ReturnsResult(lastInsertId int64, rowsAffected int64) *Expectation {
+	e.lastInsertId = lastInsertId
+	e.rowsAffected = rowsAffected
+	return e
+}
+
+// ReturnsError makes the expected query fail with err.
+func (e *Expectation) ReturnsError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Check returns an error if some expected queries have not been run.
+func (d *Database) Check() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.numConsumed < len(d.expectations) {
+		return fmt.Errorf(
+			"imosqltest: %d expected queries were not run, next: %s",
+			len(d.expectations)-d.numConsumed, d.expectations[d.numConsumed].query)
+	}
+	return nil
+}
+
+// consume returns the next expectation if it matches query and args.
+func (d *Database) consume(query string, args []driver.Value) (*Expectation, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	query = normalizeQuery(query)
+	if d.numConsumed >= len(d.expectations) {
+		return nil, fmt.Errorf("imosqltest: unexpected query: %s; %v", query, args)
+	}
+	e := d.expectations[d.numConsumed]
+	if e.query != query {
+		return nil, fmt.Errorf(
+			"imosqltest: unexpected query: expected %s, actual %s", e.query, query)
+	}
+	if e.checksArgs && (len(e.args) != 0 || len(args) != 0) &&
+		!reflect.DeepEqual(e.args, args) {
+		return nil, fmt.Errorf(
+			"imosqltest: unexpected args for %s: expected %v, actual %v",
+			query, e.args, args)
+	}
+	d.numConsumed++
+	return e, nil
+}
+
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// convertResultValue converts a value returned by a query in the same way as
+// database/sql converts arguments, except that it converts a bool into 0 or 1
+// as MySQL does.
+func convertResultValue(value interface{}) (driver.Value, error) {
+	if boolValue, ok := value.(bool); ok {
+		if boolValue {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(value)
+}
@@ -0,0 +1,81 @@
+package imosqltest_test
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/imos/imosql/imosqltest"
+	"testing"
+)
+
+func TestDatabase(t *testing.T) {
+	fake := imosqltest.NewDatabase()
+	fake.Expect("SELECT test_id, test_string FROM test WHERE test_id = ?", 1).
+		Returns(
+			[]string{"test_id", "test_string"},
+			[]interface{}{1, "foo"}, []interface{}{2, nil}).
+		ReturnsColumnTypes("BIGINT", "VARCHAR")
+	fake.Expect("UPDATE test SET test_int = 1").ReturnsResult(0, 3)
+	fake.Expect("DELETE FROM test").ReturnsError(errors.New("denied"))
+	db, err := sql.Open(imosqltest.DriverName, fake.DataSourceName())
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+	defer db.Close()
+	rows, err := db.Query(
+		"SELECT test_id, test_string\n  FROM test WHERE test_id = ?", 1)
+	if err != nil {
+		t.Fatalf("failed to query: %s", err)
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatalf("failed to get column types: %s", err)
+	}
+	if name := columnTypes[1].DatabaseTypeName(); name != "VARCHAR" {
+		t.Errorf("unexpected column type: %s.", name)
+	}
+	actual := []string{}
+	for rows.Next() {
+		var id int64
+		var value sql.NullString
+		if err := rows.Scan(&id, &value); err != nil {
+			t.Fatalf("failed to scan: %s", err)
+		}
+		actual = append(actual, value.String)
+	}
+	rows.Close()
+	if len(actual) != 2 || actual[0] != "foo" || actual[1] != "" {
+		t.Errorf("unexpected rows: %#v.", actual)
+	}
+	if err := fake.Check(); err == nil {
+		t.Errorf("Check should fail before all queries are run.")
+	}
+	result, err := db.Exec("UPDATE test SET test_int = 1")
+	if err != nil {
+		t.Fatalf("failed to exec: %s", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected != 3 {
+		t.Errorf("unexpected # of affected rows: %d.", rowsAffected)
+	}
+	if _, err := db.Exec("DELETE FROM test"); err == nil || err.Error() != "denied" {
+		t.Errorf("unexpected error: %v.", err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if _, err := db.Exec("DELETE FROM test"); err == nil {
+		t.Errorf("an unexpected query should fail.")
+	}
+}
+
+func TestDatabase_UnexpectedArgs(t *testing.T) {
+	fake := imosqltest.NewDatabase()
+	fake.Expect("SELECT ?", 1)
+	db, err := sql.Open(imosqltest.DriverName, fake.DataSourceName())
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("SELECT ?", 2); err == nil {
+		t.Errorf("a query with unexpected args should fail.")
+	}
+}
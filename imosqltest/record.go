@@ -0,0 +1,418 @@
+package imosqltest
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// RecorderDriverName is the name of the driver recording queries, which is
+// registered to database/sql.
+const RecorderDriverName = "imosqltest-recorder"
+
+var recorderRegistry = struct {
+	sync.Mutex
+	recorders map[string]*Recorder
+	count     int
+}{recorders: map[string]*Recorder{}}
+
+func init() {
+	sql.Register(RecorderDriverName, recordingDriver{})
+}
+
+// Recorder records every query run through it with its arguments and result
+// so that LoadDatabase can replay them without any SQL server.  A Recorder is
+// opened with RecorderDriverName and Recorder.DataSourceName:
+//
+//	recorder, err := imosqltest.NewRecorder("mysql", "root@/test")
+//	con, err := imosql.Open(
+//		imosqltest.RecorderDriverName, recorder.DataSourceName())
+//	...
+//	err = recorder.Save(goldenFile)
+type Recorder struct {
+	mutex          sync.Mutex
+	driver         driver.Driver
+	dataSourceName string
+	name           string
+	queries        []*goldenQuery
+}
+
+// goldenQuery is a recorded query in a golden file.
+type goldenQuery struct {
+	Query        string          `json:"query"`
+	Args         []goldenValue   `json:"args,omitempty"`
+	Columns      []string        `json:"columns,omitempty"`
+	Rows         [][]goldenValue `json:"rows,omitempty"`
+	LastInsertId int64           `json:"last_insert_id,omitempty"`
+	RowsAffected int64           `json:"rows_affected,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	// ErrorClass is the class of Error if it is a server error of a known
+	// driver.
+	ErrorClass *goldenErrorClass `json:"error_class,omitempty"`
+}
+
+// goldenErrorClass is the class of a server error, which is replayed with the
+// same fields and methods as the error of the driver so that classifiers
+// (e.g. imosql.IsDuplicateKey) work for replayed errors.  At most one field
+// is set.
+type goldenErrorClass struct {
+	// MySQLNumber is Number of *mysql.MySQLError.
+	MySQLNumber uint16 `json:"mysql_number,omitempty"`
+	// SQLState is the SQLSTATE of a PostgreSQL error.
+	SQLState string `json:"sql_state,omitempty"`
+	// SQLiteCode is the extended result code of a SQLite error.
+	SQLiteCode int `json:"sqlite_code,omitempty"`
+}
+
+// goldenValue is a driver.Value in a golden file.  It has at most one non-nil
+// field, and it represents NULL if it has none.
+type goldenValue struct {
+	Int    *int64     `json:"int,omitempty"`
+	Float  *float64   `json:"float,omitempty"`
+	Bool   *bool      `json:"bool,omitempty"`
+	Bytes  *[]byte    `json:"bytes,omitempty"`
+	String *string    `json:"string,omitempty"`
+	Time   *time.Time `json:"time,omitempty"`
+}
+
+func newGoldenValue(value driver.Value) goldenValue {
+	switch value := value.(type) {
+	case int64:
+		return goldenValue{Int: &value}
+	case float64:
+		return goldenValue{Float: &value}
+	case bool:
+		return goldenValue{Bool: &value}
+	case []byte:
+		bytes := append([]byte{}, value...)
+		return goldenValue{Bytes: &bytes}
+	case string:
+		return goldenValue{String: &value}
+	case time.Time:
+		return goldenValue{Time: &value}
+	}
+	return goldenValue{}
+}
+
+func (v goldenValue) value() driver.Value {
+	switch {
+	case v.Int != nil:
+		return *v.Int
+	case v.Float != nil:
+		return *v.Float
+	case v.Bool != nil:
+		return *v.Bool
+	case v.Bytes != nil:
+		return *v.Bytes
+	case v.String != nil:
+		return *v.String
+	case v.Time != nil:
+		return *v.Time
+	}
+	return nil
+}
+
+func newGoldenValues(values []driver.Value) []goldenValue {
+	result := make([]goldenValue, len(values))
+	for index, value := range values {
+		result[index] = newGoldenValue(value)
+	}
+	return result
+}
+
+// NewRecorder creates a Recorder running queries against a database specified
+// by a driver name and a data source name.
+func NewRecorder(driverName string, dataSourceName string) (*Recorder, error) {
+	db, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		return nil, fmt.Errorf("imosqltest: failed to open %s: %s", driverName, err)
+	}
+	defer db.Close()
+	recorderRegistry.Lock()
+	defer recorderRegistry.Unlock()
+	recorderRegistry.count++
+	r := &Recorder{
+		driver:         db.Driver(),
+		dataSourceName: dataSourceName,
+		name:           fmt.Sprintf("imosqltest-recorder-%d", recorderRegistry.count),
+	}
+	recorderRegistry.recorders[r.name] = r
+	return r, nil
+}
+
+// DataSourceName returns a data source name to open the Recorder with
+// RecorderDriverName.
+func (r *Recorder) DataSourceName() string {
+	return r.name
+}
+
+// Save writes the recorded queries to w as a golden file in JSON.
+func (r *Recorder) Save(w io.Writer) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	output, err := json.MarshalIndent(r.queries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("imosqltest: failed to encode queries: %s", err)
+	}
+	if _, err := w.Write(append(output, '\n')); err != nil {
+		return fmt.Errorf("imosqltest: failed to write queries: %s", err)
+	}
+	return nil
+}
+
+func newGoldenQuery(query string, args []driver.Value, err error) *goldenQuery {
+	q := &goldenQuery{Query: query, Args: newGoldenValues(args)}
+	if err != nil {
+		q.Error = err.Error()
+		q.ErrorClass = newGoldenErrorClass(err)
+	}
+	return q
+}
+
+// newGoldenErrorClass returns the class of an error by the same fields and
+// methods as imosql classifies errors with, or nil if it has no class.
+func newGoldenErrorClass(err error) *goldenErrorClass {
+	for ; err != nil; err = errors.Unwrap(err) {
+		value := reflect.ValueOf(err)
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return nil
+			}
+			value = value.Elem()
+		}
+		if stateError, ok := err.(interface{ SQLState() string }); ok {
+			return &goldenErrorClass{SQLState: stateError.SQLState()}
+		}
+		if codeError, ok := err.(interface{ Code() int }); ok {
+			return &goldenErrorClass{SQLiteCode: codeError.Code()}
+		}
+		if value.Kind() != reflect.Struct {
+			continue
+		}
+		if number := value.FieldByName("Number"); number.IsValid() &&
+			number.Kind() == reflect.Uint16 {
+			return &goldenErrorClass{MySQLNumber: uint16(number.Uint())}
+		}
+		code := value.FieldByName("Code")
+		if code.IsValid() && code.Kind() == reflect.String && len(code.String()) == 5 {
+			return &goldenErrorClass{SQLState: code.String()}
+		}
+		if code.IsValid() && code.Kind() == reflect.Int {
+			class := &goldenErrorClass{SQLiteCode: int(code.Int())}
+			extended := value.FieldByName("ExtendedCode")
+			if extended.IsValid() && extended.Kind() == reflect.Int && extended.Int() != 0 {
+				class.SQLiteCode = int(extended.Int())
+			}
+			return class
+		}
+	}
+	return nil
+}
+
+// replayedMySQLError is a replayed error of github.com/go-sql-driver/mysql.
+type replayedMySQLError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *replayedMySQLError) Error() string {
+	return e.Message
+}
+
+// replayedPostgreSQLError is a replayed error of a PostgreSQL driver.
+type replayedPostgreSQLError struct {
+	state   string
+	message string
+}
+
+func (e *replayedPostgreSQLError) Error() string {
+	return e.message
+}
+
+func (e *replayedPostgreSQLError) SQLState() string {
+	return e.state
+}
+
+// replayedSQLiteError is a replayed error of a SQLite driver.
+type replayedSQLiteError struct {
+	code    int
+	message string
+}
+
+func (e *replayedSQLiteError) Error() string {
+	return e.message
+}
+
+func (e *replayedSQLiteError) Code() int {
+	return e.code
+}
+
+// replayedError returns an error replaying a recorded error.  Errors without
+// classes (e.g. network errors) are replayed only with their messages, so
+// errors.Is and errors.As do not match them.
+func (q *goldenQuery) replayedError() error {
+	switch class := q.ErrorClass; {
+	case class == nil:
+		return errors.New(q.Error)
+	case class.MySQLNumber != 0:
+		return &replayedMySQLError{Number: class.MySQLNumber, Message: q.Error}
+	case class.SQLState != "":
+		return &replayedPostgreSQLError{state: class.SQLState, message: q.Error}
+	case class.SQLiteCode != 0:
+		return &replayedSQLiteError{code: class.SQLiteCode, message: q.Error}
+	}
+	return errors.New(q.Error)
+}
+
+func (r *Recorder) record(q *goldenQuery) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.queries = append(r.queries, q)
+}
+
+// LoadDatabase creates a Database expecting the queries in a golden file
+// written by Recorder.Save in the same order, which replays their results.
+// Server errors of known drivers are replayed with their error numbers (or
+// SQLSTATEs), and other errors are replayed only with their messages.
+func LoadDatabase(reader io.Reader) (*Database, error) {
+	queries := []goldenQuery{}
+	if err := json.NewDecoder(reader).Decode(&queries); err != nil {
+		return nil, fmt.Errorf("imosqltest: failed to decode queries: %s", err)
+	}
+	d := NewDatabase()
+	for _, q := range queries {
+		e := &Expectation{
+			query:        normalizeQuery(q.Query),
+			checksArgs:   true,
+			columns:      q.Columns,
+			lastInsertId: q.LastInsertId,
+			rowsAffected: q.RowsAffected,
+		}
+		for _, arg := range q.Args {
+			e.args = append(e.args, arg.value())
+		}
+		for _, row := range q.Rows {
+			values := make([]driver.Value, len(row))
+			for index, value := range row {
+				values[index] = value.value()
+			}
+			e.rows = append(e.rows, values)
+		}
+		if q.Error != "" {
+			e.err = q.replayedError()
+		}
+		d.expectations = append(d.expectations, e)
+	}
+	return d, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Recording driver
+////////////////////////////////////////////////////////////////////////////////
+
+type recordingDriver struct{}
+
+func (recordingDriver) Open(name string) (driver.Conn, error) {
+	recorderRegistry.Lock()
+	recorder, ok := recorderRegistry.recorders[name]
+	recorderRegistry.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("imosqltest: unknown data source name: %s", name)
+	}
+	conn, err := recorder.driver.Open(recorder.dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingConn{recorder: recorder, conn: conn}, nil
+}
+
+type recordingConn struct {
+	recorder *Recorder
+	conn     driver.Conn
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.conn.Prepare(query)
+	if err != nil {
+		c.recorder.record(newGoldenQuery(query, nil, err))
+		return nil, err
+	}
+	return &recordingStmt{conn: c, stmt: stmt, query: query}, nil
+}
+
+func (c *recordingConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	return c.conn.Begin()
+}
+
+type recordingStmt struct {
+	conn  *recordingConn
+	stmt  driver.Stmt
+	query string
+}
+
+func (s *recordingStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *recordingStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	result, err := s.stmt.Exec(args)
+	q := newGoldenQuery(s.query, args, err)
+	if err == nil {
+		// Errors are ignored because some drivers do not support them.
+		q.LastInsertId, _ = result.LastInsertId()
+		q.RowsAffected, _ = result.RowsAffected()
+	}
+	s.conn.recorder.record(q)
+	return result, err
+}
+
+func (s *recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, err := s.stmt.Query(args)
+	q := newGoldenQuery(s.query, args, err)
+	if err == nil {
+		q.Columns = rows.Columns()
+	}
+	s.conn.recorder.record(q)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingRows{recorder: s.conn.recorder, query: q, rows: rows}, nil
+}
+
+type recordingRows struct {
+	recorder *Recorder
+	query    *goldenQuery
+	rows     driver.Rows
+}
+
+func (r *recordingRows) Columns() []string {
+	return r.rows.Columns()
+}
+
+func (r *recordingRows) Close() error {
+	return r.rows.Close()
+}
+
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if err := r.rows.Next(dest); err != nil {
+		return err
+	}
+	r.recorder.mutex.Lock()
+	defer r.recorder.mutex.Unlock()
+	r.query.Rows = append(r.query.Rows, newGoldenValues(dest))
+	return nil
+}
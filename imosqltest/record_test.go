@@ -0,0 +1,98 @@
+package imosqltest_test
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"github.com/imos/imosql"
+	"github.com/imos/imosql/imosqltest"
+	"testing"
+)
+
+// mysqlError has the same fields as *mysql.MySQLError.
+type mysqlError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *mysqlError) Error() string {
+	return e.Message
+}
+
+// runQueries runs queries used to test recording and replaying.
+func runQueries(t *testing.T, db *sql.DB) {
+	var value sql.NullString
+	if err := db.QueryRow("SELECT test_string FROM test WHERE test_id = ?", 1).
+		Scan(&value); err != nil {
+		t.Fatalf("failed to query: %s", err)
+	}
+	if value.String != "foo" {
+		t.Errorf("unexpected value: %#v.", value)
+	}
+	result, err := db.Exec("UPDATE test SET test_string = ?", []byte("bar"))
+	if err != nil {
+		t.Fatalf("failed to exec: %s", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected != 2 {
+		t.Errorf("unexpected # of affected rows: %d.", rowsAffected)
+	}
+	if err := db.QueryRow("SELECT test_string FROM test WHERE test_id = ?", 2).
+		Scan(&value); err != nil {
+		t.Fatalf("failed to query: %s", err)
+	}
+	if !value.Valid || value.String != "" {
+		t.Errorf("an empty value should not be NULL: %#v.", value)
+	}
+	if _, err := db.Exec("DELETE FROM test"); err == nil {
+		t.Errorf("DELETE should fail.")
+	}
+	_, err = db.Exec("INSERT INTO test (test_id) VALUES (?)", 1)
+	if !imosql.IsDuplicateKey(err) {
+		t.Errorf("INSERT should fail with a duplicate key: %#v.", err)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	fake := imosqltest.NewDatabase()
+	fake.Expect("SELECT test_string FROM test WHERE test_id = ?", 1).
+		Returns([]string{"test_string"}, []interface{}{"foo"})
+	fake.Expect("UPDATE test SET test_string = ?", []byte("bar")).
+		ReturnsResult(0, 2)
+	fake.Expect("SELECT test_string FROM test WHERE test_id = ?", 2).
+		Returns([]string{"test_string"}, []interface{}{[]byte{}})
+	fake.Expect("DELETE FROM test").ReturnsError(errors.New("denied"))
+	fake.Expect("INSERT INTO test (test_id) VALUES (?)", 1).ReturnsError(
+		&mysqlError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"})
+	recorder, err := imosqltest.NewRecorder(
+		imosqltest.DriverName, fake.DataSourceName())
+	if err != nil {
+		t.Fatalf("failed to create a recorder: %s", err)
+	}
+	db, err := sql.Open(imosqltest.RecorderDriverName, recorder.DataSourceName())
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+	runQueries(t, db)
+	db.Close()
+	golden := bytes.Buffer{}
+	if err := recorder.Save(&golden); err != nil {
+		t.Fatalf("failed to save: %s", err)
+	}
+
+	replay, err := imosqltest.LoadDatabase(&golden)
+	if err != nil {
+		t.Fatalf("failed to load: %s", err)
+	}
+	db, err = sql.Open(imosqltest.DriverName, replay.DataSourceName())
+	if err != nil {
+		t.Fatalf("failed to open: %s", err)
+	}
+	defer db.Close()
+	runQueries(t, db)
+	if err := replay.Check(); err != nil {
+		t.Error(err)
+	}
+	if _, err := db.Exec("SELECT 1"); err == nil {
+		t.Errorf("an unexpected query should fail.")
+	}
+}
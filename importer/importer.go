@@ -0,0 +1,461 @@
+// Package importer loads rows from CSV, TSV or JSON Lines into a table.
+// Values are read as follows:
+//
+//   - CSV must have a header, and an empty field is NULL.
+//   - TSV must have a header, and is unescaped in the same way as MySQL's
+//     LOAD DATA INFILE, where \N is NULL.
+//   - JSON Lines has an object for every row, whose keys are column names.
+//     Values must be strings, numbers, booleans or null.
+//   - Values of []byte fields of a row struct (see Importer.SetRow) are
+//     decoded from base64, in which the export package writes binary
+//     values.  Without a row struct, values are inserted as they are.
+//
+// Rows are inserted in batches of multi-row INSERT statements in a single
+// transaction.
+package importer
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/imos/imosql"
+	"github.com/imos/imosql/export"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DefaultBatchSize is the default number of rows inserted by a statement.
+const DefaultBatchSize = 500
+
+// maxPlaceholders returns the maximum number of placeholders in a statement
+// of a dialect.  SQLite before 3.32.0 allows only 999 bind variables.
+func maxPlaceholders(dialect imosql.Dialect) int {
+	switch dialect.(type) {
+	case imosql.MySQLDialect, imosql.PostgreSQLDialect:
+		return 65535
+	default:
+		return 999
+	}
+}
+
+// Importer loads rows into a table.
+type Importer struct {
+	Table string
+	// Columns maps names in an input (i.e. CSV headers or JSON keys) to
+	// column names.  Names missing in Columns are used as column names as
+	// they are, and names mapped to an empty string are skipped.
+	Columns map[string]string
+	// BatchSize is the maximum number of rows inserted by a statement.  It
+	// is reduced so that a statement does not exceed the maximum number of
+	// placeholders of the dialect.
+	BatchSize int
+	// DryRun disables inserting rows.  Rows are still read, validated and
+	// converted, so that errors in an input are reported.
+	DryRun bool
+	// Progress is called with the total number of processed rows after every
+	// batch if it is not nil.
+	Progress func(numRows int)
+	rowType  reflect.Type
+}
+
+// New creates an Importer loading rows into a table.
+func New(table string) *Importer {
+	return &Importer{Table: table, BatchSize: DefaultBatchSize}
+}
+
+// SetRow sets a row struct with sql tags to validate and convert rows: every
+// column must have a corresponding field, and every value is parsed in the
+// same way as imosql.RowReader does.
+func (i *Importer) SetRow(row interface{}) error {
+	rowType := reflect.TypeOf(row)
+	for rowType != nil && rowType.Kind() == reflect.Ptr {
+		rowType = rowType.Elem()
+	}
+	if rowType == nil || rowType.Kind() != reflect.Struct {
+		return fmt.Errorf("row must be a struct but %T.", row)
+	}
+	i.rowType = rowType
+	return nil
+}
+
+// recordReader reads records of an input.  A nil value represents NULL.
+type recordReader interface {
+	// Read returns the next record with its names, or io.EOF at the end of
+	// the input.
+	Read() (names []string, values []*string, err error)
+}
+
+// Import reads rows from r in a format and inserts them into the table.  If
+// con is already in a transaction, Import uses it.  Import returns the number
+// of rows inserted, or the number of rows read in dry-run mode.  The
+// transaction is never retried by the retry policy of con because r cannot be
+// read again.
+func (i *Importer) Import(con *imosql.Connection, r io.Reader, format export.Format) (int, error) {
+	var reader recordReader
+	switch format {
+	case export.CSV:
+		reader = &csvReader{reader: csv.NewReader(r)}
+	case export.TSV:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		reader = &tsvReader{scanner: scanner}
+	case export.JSONLines:
+		decoder := json.NewDecoder(r)
+		decoder.UseNumber()
+		reader = &jsonLinesReader{decoder: decoder}
+	default:
+		return 0, fmt.Errorf("unsupported format: %s.", format)
+	}
+	if i.DryRun {
+		return i.load(con.Dialect(), nil, reader)
+	}
+	var numRows int
+	load := func(tx *imosql.Connection) (err error) {
+		numRows, err = i.load(con.Dialect(), tx, reader)
+		return
+	}
+	var err error
+	if con.InTransaction() {
+		err = load(con)
+	} else {
+		err = con.NoRetry().Transaction(load)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return numRows, nil
+}
+
+// load reads records and inserts them in batches.  Values are parsed with
+// dialect, and tx is nil in dry-run mode.
+func (i *Importer) load(dialect imosql.Dialect, tx *imosql.Connection, reader recordReader) (int, error) {
+	batchSize := i.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	var converter *rowConverter
+	var columns []string
+	columnsBatchSize := batchSize
+	batch := [][]interface{}{}
+	numRows := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if tx != nil {
+			if err := i.insert(tx, columns, batch); err != nil {
+				rows := fmt.Sprintf("rows #%d-#%d", numRows-len(batch)+1, numRows)
+				if len(batch) == 1 {
+					rows = fmt.Sprintf("row #%d", numRows)
+				}
+				return fmt.Errorf("failed to insert %s into %s: %w", rows, i.Table, err)
+			}
+		}
+		batch = batch[:0]
+		if i.Progress != nil {
+			i.Progress(numRows)
+		}
+		return nil
+	}
+	for {
+		names, values, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, fmt.Errorf("failed to read row #%d: %s", numRows+1, err)
+		}
+		rowColumns, rowValues := i.mapColumns(names, values)
+		if len(rowColumns) == 0 {
+			return 0, fmt.Errorf("row #%d has no columns.", numRows+1)
+		}
+		// A statement inserts rows with the same columns, which may differ
+		// between objects in JSON Lines.
+		if !equalStrings(columns, rowColumns) {
+			if err := flush(); err != nil {
+				return 0, err
+			}
+			columns = rowColumns
+			columnsBatchSize = batchSize
+			if limit := maxPlaceholders(dialect) / len(columns); limit < columnsBatchSize {
+				columnsBatchSize = limit
+			}
+			if columnsBatchSize <= 0 {
+				return 0, fmt.Errorf("row #%d has too many columns: %d.", numRows+1, len(columns))
+			}
+			if i.rowType != nil {
+				if converter, err = newRowConverter(i.rowType, columns, dialect); err != nil {
+					return 0, err
+				}
+			}
+		}
+		row := make([]interface{}, len(rowValues))
+		if converter != nil {
+			row, err = converter.Convert(rowValues)
+			if err != nil {
+				return 0, fmt.Errorf("invalid row #%d: %s", numRows+1, err)
+			}
+		} else {
+			for index, value := range rowValues {
+				if value != nil {
+					row[index] = *value
+				}
+			}
+		}
+		batch = append(batch, row)
+		numRows++
+		if len(batch) >= columnsBatchSize {
+			if err := flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return 0, err
+	}
+	return numRows, nil
+}
+
+// mapColumns maps names in an input to columns with Importer.Columns.
+func (i *Importer) mapColumns(names []string, values []*string) ([]string, []*string) {
+	columns := []string{}
+	columnValues := []*string{}
+	for index, name := range names {
+		if column, ok := i.Columns[name]; ok {
+			if column == "" {
+				continue
+			}
+			name = column
+		}
+		columns = append(columns, name)
+		columnValues = append(columnValues, values[index])
+	}
+	return columns, columnValues
+}
+
+// insert inserts rows with a multi-row INSERT statement.  Positional
+// placeholders are replaced with the ones of the dialect by imosql.
+func (i *Importer) insert(tx *imosql.Connection, columns []string, rows [][]interface{}) error {
+	dialect := tx.Dialect()
+	quotedColumns := make([]string, len(columns))
+	for index, column := range columns {
+		quotedColumns[index] = dialect.QuoteIdentifier(column)
+	}
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	tuples := make([]string, len(rows))
+	args := []interface{}{}
+	for index, row := range rows {
+		tuples[index] = placeholders
+		args = append(args, row...)
+	}
+	_, err := tx.Execute(fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES %s", dialect.QuoteIdentifier(i.Table),
+		strings.Join(quotedColumns, ", "), strings.Join(tuples, ", ")), args...)
+	return err
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for index := range a {
+		if a[index] != b[index] {
+			return false
+		}
+	}
+	return true
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Conversion
+////////////////////////////////////////////////////////////////////////////////
+
+// rowConverter converts values of columns with a row struct.
+type rowConverter struct {
+	rowReader    *imosql.RowReader
+	fieldIndexes []int
+	// binary is true for columns of []byte fields, which are decoded from
+	// base64 instead of being parsed by rowReader.
+	binary []bool
+}
+
+func newRowConverter(rowType reflect.Type, columns []string, dialect imosql.Dialect) (*rowConverter, error) {
+	columnToFieldIndex := map[string]int{}
+	for fieldIndex := 0; fieldIndex < rowType.NumField(); fieldIndex++ {
+		columnToFieldIndex[imosql.ColumnName(rowType.Field(fieldIndex))] = fieldIndex
+	}
+	converter := &rowConverter{}
+	for _, column := range columns {
+		fieldIndex, ok := columnToFieldIndex[column]
+		if !ok {
+			return nil, fmt.Errorf("unknown column: %s.", column)
+		}
+		converter.fieldIndexes = append(converter.fieldIndexes, fieldIndex)
+		converter.binary = append(converter.binary,
+			rowType.Field(fieldIndex).Type == reflect.TypeOf([]byte(nil)))
+	}
+	rowReader, err := imosql.NewRowReader(
+		reflect.New(reflect.SliceOf(rowType)).Interface())
+	if err != nil {
+		return nil, err
+	}
+	if err := rowReader.SetColumns(columns); err != nil {
+		return nil, err
+	}
+	rowReader.SetDialect(dialect)
+	converter.rowReader = rowReader
+	return converter, nil
+}
+
+// Convert parses values into the fields of a row struct, and returns the
+// values of the fields.  NULL values are kept nil.
+func (c *rowConverter) Convert(values []*string) ([]interface{}, error) {
+	result := make([]interface{}, len(values))
+	fields := make([]sql.NullString, len(values))
+	for index, value := range values {
+		if value == nil {
+			continue
+		}
+		if c.binary[index] {
+			binary, err := base64.StdEncoding.DecodeString(*value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 value: %s", err)
+			}
+			result[index] = binary
+			continue
+		}
+		fields[index] = sql.NullString{String: *value, Valid: true}
+	}
+	row, err := c.rowReader.ParseFields(fields)
+	if err != nil {
+		return nil, err
+	}
+	for index, fieldIndex := range c.fieldIndexes {
+		if fields[index].Valid {
+			result[index] = row.Elem().Field(fieldIndex).Interface()
+		}
+	}
+	return result, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Formats
+////////////////////////////////////////////////////////////////////////////////
+
+type csvReader struct {
+	reader *csv.Reader
+	header []string
+}
+
+func (r *csvReader) Read() ([]string, []*string, error) {
+	if r.header == nil {
+		header, err := r.reader.Read()
+		if err != nil {
+			return nil, nil, err
+		}
+		r.header = header
+	}
+	record, err := r.reader.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	values := make([]*string, len(record))
+	for index := range record {
+		if record[index] != "" {
+			values[index] = &record[index]
+		}
+	}
+	return r.header, values, nil
+}
+
+type tsvReader struct {
+	scanner *bufio.Scanner
+	header  []string
+}
+
+var tsvUnescaper = strings.NewReplacer(
+	`\\`, `\`, `\t`, "\t", `\n`, "\n", `\r`, "\r", `\0`, "\x00")
+
+func (r *tsvReader) readLine() ([]*string, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	fields := strings.Split(r.scanner.Text(), "\t")
+	values := make([]*string, len(fields))
+	for index, field := range fields {
+		if field != `\N` {
+			value := tsvUnescaper.Replace(field)
+			values[index] = &value
+		}
+	}
+	return values, nil
+}
+
+func (r *tsvReader) Read() ([]string, []*string, error) {
+	if r.header == nil {
+		values, err := r.readLine()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, value := range values {
+			if value == nil {
+				return nil, nil, fmt.Errorf("header must not have NULL.")
+			}
+			r.header = append(r.header, *value)
+		}
+	}
+	values, err := r.readLine()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(values) != len(r.header) {
+		return nil, nil, fmt.Errorf(
+			"# of fields must be %d but %d.", len(r.header), len(values))
+	}
+	return r.header, values, nil
+}
+
+type jsonLinesReader struct {
+	decoder *json.Decoder
+}
+
+// Read returns the keys of an object in alphabetical order.
+func (r *jsonLinesReader) Read() ([]string, []*string, error) {
+	object := map[string]interface{}{}
+	if err := r.decoder.Decode(&object); err != nil {
+		return nil, nil, err
+	}
+	names := []string{}
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := make([]*string, len(names))
+	for index, name := range names {
+		var value string
+		switch objectValue := object[name].(type) {
+		case nil:
+			continue
+		case string:
+			value = objectValue
+		case json.Number:
+			value = objectValue.String()
+		case bool:
+			value = "0"
+			if objectValue {
+				value = "1"
+			}
+		default:
+			return nil, nil, fmt.Errorf("unsupported value for %s: %T", name, objectValue)
+		}
+		values[index] = &value
+	}
+	return names, values, nil
+}
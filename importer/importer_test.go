@@ -0,0 +1,229 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/imos/imosql"
+	"github.com/imos/imosql/export"
+	"github.com/imos/imosql/imosqltest/fakedb"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testRow struct {
+	Id      int64      `sql:"user_id"`
+	Name    string     `sql:"user_name"`
+	Created *time.Time `sql:"user_created"`
+}
+
+func TestImport_CSV(t *testing.T) {
+	con, fake := fakedb.Open(t)
+	created := time.Date(2000, 1, 2, 3, 4, 5, 0, time.UTC)
+	fake.Expect(
+		"INSERT INTO `users` (`user_id`, `user_name`, `user_created`) "+
+			"VALUES (?, ?, ?), (?, ?, ?)",
+		1, "foo", created, 2, nil, nil).ReturnsResult(0, 2)
+	fake.Expect(
+		"INSERT INTO `users` (`user_id`, `user_name`, `user_created`) VALUES (?, ?, ?)",
+		3, "baz", nil).ReturnsResult(0, 1)
+	importer := New("users")
+	importer.BatchSize = 2
+	importer.Columns = map[string]string{"id": "user_id", "note": ""}
+	if err := importer.SetRow(testRow{}); err != nil {
+		t.Fatal(err)
+	}
+	progress := []int{}
+	importer.Progress = func(numRows int) { progress = append(progress, numRows) }
+	numRows, err := importer.Import(con, strings.NewReader(
+		"id,user_name,user_created,note\n"+
+			"1,foo,2000-01-02T03:04:05Z,a\n"+
+			"2,,,b\n"+
+			"3,baz,,c\n"), export.CSV)
+	if err != nil {
+		t.Fatalf("failed to import: %s", err)
+	}
+	if numRows != 3 || len(progress) != 2 || progress[1] != 3 {
+		t.Errorf("unexpected # of rows: %d, %v.", numRows, progress)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestImport_PostgreSQL(t *testing.T) {
+	con, fake := fakedb.Open(t)
+	con.SetDialect(imosql.PostgreSQLDialect{})
+	fake.Expect(
+		`INSERT INTO "users" ("user_id", "user_created") VALUES ($1, $2)`,
+		1, time.Date(2000, 1, 2, 3, 4, 5, 0, time.UTC)).ReturnsResult(0, 1)
+	importer := New("users")
+	if err := importer.SetRow(testRow{}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := importer.Import(con, strings.NewReader(
+		"user_id,user_created\n1,2000-01-02 12:04:05+09\n"), export.CSV)
+	if err != nil {
+		t.Fatalf("failed to import: %s", err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestImport_JSONLines(t *testing.T) {
+	con, fake := fakedb.Open(t)
+	fake.Expect(
+		"INSERT INTO `users` (`user_id`, `user_name`) VALUES (?, ?), (?, ?)",
+		"1", "foo", "2", nil)
+	fake.Expect("INSERT INTO `users` (`user_admin`, `user_id`) VALUES (?, ?)",
+		"1", "3")
+	numRows, err := New("users").Import(con, strings.NewReader(
+		`{"user_id": 1, "user_name": "foo"}`+"\n"+
+			`{"user_name": null, "user_id": 2}`+"\n"+
+			`{"user_id": 3, "user_admin": true}`+"\n"), export.JSONLines)
+	if err != nil {
+		t.Fatalf("failed to import: %s", err)
+	}
+	if numRows != 3 {
+		t.Errorf("unexpected # of rows: %d.", numRows)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestImport_TSV(t *testing.T) {
+	con, fake := fakedb.Open(t)
+	fake.Expect("INSERT INTO `users` (`user_id`, `user_name`) VALUES (?, ?)",
+		"1", "a\tb\\").ReturnsError(errors.New("duplicate entry"))
+	_, err := New("users").Import(con, strings.NewReader(
+		"user_id\tuser_name\n1\ta\\tb\\\\\n"), export.TSV)
+	if err == nil || !strings.Contains(err.Error(), "duplicate entry") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestImport_DryRun(t *testing.T) {
+	con, fake := fakedb.Open(t)
+	importer := New("users")
+	importer.DryRun = true
+	if err := importer.SetRow(testRow{}); err != nil {
+		t.Fatal(err)
+	}
+	numRows, err := importer.Import(con, strings.NewReader(
+		"user_id,user_name\n1,foo\n2,bar\n"), export.CSV)
+	if err != nil || numRows != 2 {
+		t.Errorf("unexpected result: %d, %v", numRows, err)
+	}
+	_, err = importer.Import(con, strings.NewReader(
+		"user_id,user_name\n1,foo\nbar,bar\n"), export.CSV)
+	if err == nil || !strings.Contains(err.Error(), "row #2") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	_, err = importer.Import(con, strings.NewReader(
+		"user_id,user_email\n1,foo\n"), export.CSV)
+	if err == nil || !strings.Contains(err.Error(), "unknown column") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestImport_Binary(t *testing.T) {
+	con, fake := fakedb.Open(t)
+	fake.Expect("INSERT INTO `files` (`file_id`, `file_body`) VALUES (?, ?), (?, ?)",
+		1, []byte("\x00\xff"), 2, nil).ReturnsResult(0, 2)
+	importer := New("files")
+	type fileRow struct {
+		Id   int64  `sql:"file_id"`
+		Body []byte `sql:"file_body"`
+	}
+	if err := importer.SetRow(fileRow{}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := importer.Import(con, strings.NewReader(
+		"file_id,file_body\n1,AP8=\n2,\n"), export.CSV)
+	if err != nil {
+		t.Fatalf("failed to import: %s", err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+	_, err = importer.Import(con, strings.NewReader(
+		"file_id,file_body\n1,#\n"), export.CSV)
+	if err == nil || !strings.Contains(err.Error(), "base64") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestImport_MaxPlaceholders(t *testing.T) {
+	con, fake := fakedb.Open(t)
+	con.SetDialect(imosql.SQLiteDialect{})
+	columns := make([]string, 400)
+	values := make([]string, 400)
+	for index := range columns {
+		columns[index] = fmt.Sprintf("c%d", index)
+		values[index] = "1"
+	}
+	input := strings.Join(columns, ",") + "\n"
+	for row := 0; row < 3; row++ {
+		input += strings.Join(values, ",") + "\n"
+	}
+	quotedColumns := `"` + strings.Join(columns, `", "`) + `"`
+	placeholders := make([]string, 400)
+	for index := range placeholders {
+		placeholders[index] = "?"
+	}
+	tuple := "(" + strings.Join(placeholders, ", ") + ")"
+	args := make([]interface{}, 800)
+	for index := range args {
+		args[index] = "1"
+	}
+	// SQLite allows 999 placeholders, which are enough for 2 rows.
+	fake.Expect("INSERT INTO \"t\" ("+quotedColumns+") VALUES "+tuple+", "+tuple,
+		args...).ReturnsResult(0, 2)
+	fake.Expect("INSERT INTO \"t\" ("+quotedColumns+") VALUES "+tuple,
+		args[:400]...).ReturnsResult(0, 1)
+	numRows, err := New("t").Import(con, strings.NewReader(input), export.CSV)
+	if err != nil || numRows != 3 {
+		t.Errorf("unexpected result: %d, %v", numRows, err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+// mysqlError has the same fields as MySQLError of
+// github.com/go-sql-driver/mysql.
+type mysqlError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *mysqlError) Error() string {
+	return e.Message
+}
+
+func TestImport_NoRetry(t *testing.T) {
+	con, fake := fakedb.Open(t)
+	con.SetRetryPolicy(&imosql.RetryPolicy{MaxAttempts: 3})
+	query := "INSERT INTO `users` (`user_id`, `user_name`) VALUES (?, ?)"
+	fake.Expect(query, "1", "foo").ReturnsResult(0, 1)
+	fake.Expect(query, "2", "bar").ReturnsError(&mysqlError{1213, "Deadlock found"})
+	importer := New("users")
+	importer.BatchSize = 1
+	// A retried transaction would skip the rows already read and succeed.
+	_, err := importer.Import(con, strings.NewReader(
+		"user_id,user_name\n1,foo\n2,bar\n"), export.CSV)
+	if !imosql.IsDeadlock(err) {
+		t.Errorf("the deadlock should be returned: %v", err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
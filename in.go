@@ -0,0 +1,81 @@
+package imosql
+
+import (
+	"reflect"
+	"strings"
+)
+
+// InValues is an argument expanded into a comma-separated list of
+// placeholders, which is created by In.
+type InValues struct {
+	values []interface{}
+	err    error
+}
+
+// In marks a slice (or an array) as an argument for an IN clause.  When it is
+// passed to a query function, the placeholder corresponding to it is expanded
+// into as many placeholders as the slice has elements, e.g.
+// con.Rows(&rows, "SELECT * FROM test WHERE test_id IN (?)", imosql.In(ids)).
+// An empty slice is expanded into NULL so that IN (...) matches no rows.  Be
+// careful that NOT IN (NULL) also matches no rows.
+func In(slice interface{}) InValues {
+	value := reflect.ValueOf(slice)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return InValues{
+			err: errorf("In requires a slice but %s.", value.Kind().String())}
+	}
+	values := make([]interface{}, value.Len())
+	for index := range values {
+		values[index] = value.Index(index).Interface()
+	}
+	return InValues{values: values}
+}
+
+// expandArgs expands placeholders corresponding to InValues arguments in a
+// query of dialect.  If there are no InValues arguments, it returns query and
+// args as they are.
+func expandArgs(dialect Dialect, query string, args []interface{}) (string, []interface{}, error) {
+	hasInValues := false
+	for _, arg := range args {
+		if _, ok := arg.(InValues); ok {
+			hasInValues = true
+			break
+		}
+	}
+	if !hasInValues {
+		return query, args, nil
+	}
+	expandedArgs := make([]interface{}, 0, len(args))
+	argIndex := 0
+	expandedQuery, err := rewritePlaceholders(dialect, query, func(name string) (string, error) {
+		if name != "" {
+			return ":" + name, nil
+		}
+		if argIndex >= len(args) {
+			return "", errorf("# of placeholders exceeds # of args: %d.", len(args))
+		}
+		arg := args[argIndex]
+		argIndex++
+		inValues, ok := arg.(InValues)
+		if !ok {
+			expandedArgs = append(expandedArgs, arg)
+			return "?", nil
+		}
+		if inValues.err != nil {
+			return "", inValues.err
+		}
+		if len(inValues.values) == 0 {
+			return "NULL", nil
+		}
+		expandedArgs = append(expandedArgs, inValues.values...)
+		return strings.Repeat("?, ", len(inValues.values)-1) + "?", nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if argIndex < len(args) {
+		return "", nil, errorf(
+			"# of args exceeds # of placeholders: %d > %d.", len(args), argIndex)
+	}
+	return expandedQuery, expandedArgs, nil
+}
@@ -0,0 +1,62 @@
+package imosql_test
+
+import (
+	imosql "."
+	"testing"
+)
+
+func TestIn(t *testing.T) {
+	openDatabase()
+	if db == nil {
+		return
+	}
+	rows := []TestRow{}
+	db.RowsOrDie(
+		&rows, "SELECT test_id FROM test WHERE test_id IN (?) AND test_int < ? "+
+			"ORDER BY test_id",
+		imosql.In([]int64{1, 3, 4}), 10)
+	checkInterfaceEqual(
+		t,
+		`[{"Id": 1, "String": "", "Int": 0, "Time": "0001-01-01T00:00:00Z"},
+		  {"Id": 3, "String": "", "Int": 0, "Time": "0001-01-01T00:00:00Z"}]`,
+		rows)
+	db.RowsOrDie(
+		&rows, "SELECT test_id FROM test WHERE test_id IN (?)",
+		imosql.In([]int64{}))
+	checkInterfaceEqual(t, "[]", rows)
+	if err := db.Rows(
+		&rows, "SELECT * FROM test WHERE test_id IN (?)", imosql.In(1)); err == nil {
+		t.Errorf("In should fail for a non-slice argument.")
+	}
+}
+
+func TestIn_Fake(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	// An empty slice matches no rows.
+	fake.Expect("SELECT test_id FROM test WHERE test_id IN (NULL) AND test_int < ?", 10).
+		Returns([]string{"test_id"})
+	// []byte is a single value, and In expands a slice of them into values.
+	fake.Expect("SELECT test_id FROM test WHERE test_blob = ? AND test_blob IN (?, ?)",
+		[]byte("a"), []byte("b"), []byte("c")).Returns([]string{"test_id"})
+	// Several In arguments are expanded in order.
+	fake.Expect("SELECT test_id FROM test WHERE test_id IN (?, ?) AND test_int < ? "+
+		"AND test_string IN (?, ?, ?)", 1, 2, 10, "x", "y", "z").
+		Returns([]string{"test_id"}, []interface{}{1})
+	rows := []TestRow{}
+	con.RowsOrDie(&rows,
+		"SELECT test_id FROM test WHERE test_id IN (?) AND test_int < ?",
+		imosql.In([]int64{}), 10)
+	con.RowsOrDie(&rows,
+		"SELECT test_id FROM test WHERE test_blob = ? AND test_blob IN (?)",
+		[]byte("a"), imosql.In([][]byte{[]byte("b"), []byte("c")}))
+	con.RowsOrDie(&rows,
+		"SELECT test_id FROM test WHERE test_id IN (?) AND test_int < ? "+
+			"AND test_string IN (?)",
+		imosql.In([]int{1, 2}), 10, imosql.In([]string{"x", "y", "z"}))
+	if len(rows) != 1 || rows[0].Id != 1 {
+		t.Errorf("unexpected rows: %#v.", rows)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,101 @@
+package imosql
+
+import (
+	"database/sql"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// isAutoIncrement returns true iff a field of a row struct has the
+// autoincrement option in its sql tag.
+func isAutoIncrement(field reflect.StructField) bool {
+	for _, option := range strings.Split(field.Tag.Get("sql"), ",")[1:] {
+		if strings.TrimSpace(option) == "autoincrement" {
+			return true
+		}
+	}
+	return false
+}
+
+// rowColumns returns columns and their values of row, which must be a struct
+// with sql tags, a map with string keys or a pointer to either of them.
+// Columns of a map are sorted by their names.  Autoincrement fields with zero
+// values are omitted so that the server fills them.
+func rowColumns(row interface{}) (columns []string, values []interface{}, err error) {
+	value := reflect.ValueOf(row)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			err = errorf("row must not be a nil pointer.")
+			return
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			err = errorf(
+				"row must be a map with string keys but a map with %s keys.",
+				value.Type().Key().String())
+			return
+		}
+		for _, key := range value.MapKeys() {
+			columns = append(columns, key.String())
+		}
+		sort.Strings(columns)
+		for _, column := range columns {
+			values = append(values, value.MapIndex(
+				reflect.ValueOf(column).Convert(value.Type().Key())).Interface())
+		}
+	case reflect.Struct:
+		if _, ok := value.Interface().(time.Time); ok {
+			err = errorf("row must be a map or a struct but time.Time.")
+			return
+		}
+		for fieldIndex := 0; fieldIndex < value.NumField(); fieldIndex++ {
+			field := value.Type().Field(fieldIndex)
+			column := ColumnName(field)
+			if column == "" {
+				err = errorf(
+					"every field of a row struct must have a sql tag: %s", field.Name)
+				return
+			}
+			if isAutoIncrement(field) && value.Field(fieldIndex).IsZero() {
+				continue
+			}
+			columns = append(columns, column)
+			values = append(values, value.Field(fieldIndex).Interface())
+		}
+	default:
+		err = errorf("row must be a map or a struct but %s.", value.Kind().String())
+		return
+	}
+	if len(columns) == 0 {
+		err = errorf("row must have at least one column.")
+	}
+	return
+}
+
+// Insert inserts a row into table.  row must be a struct whose fields have sql
+// tags, a map from column names to values (e.g. map[string]interface{}) or a
+// pointer to either of them.  Every field of a struct is inserted except
+// autoincrement fields with zero values (see NewTableSchema), and nil
+// pointers are inserted as NULL.
+func (c *Connection) Insert(table string, row interface{}) (sql.Result, error) {
+	columns, values, err := rowColumns(row)
+	if err != nil {
+		return nil, err
+	}
+	return c.Execute(insertStatement(c.Dialect(), table, columns), values...)
+}
+
+// InsertOrDie runs Connection.Insert.  If Connection.Insert fails, this
+// function panics.
+func (c *Connection) InsertOrDie(table string, row interface{}) sql.Result {
+	result, err := c.Insert(table, row)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
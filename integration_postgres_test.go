@@ -0,0 +1,7 @@
+//go:build postgres
+// +build postgres
+
+package imosql_test
+
+// The PostgreSQL driver is linked only for make integration-test-postgres.
+import _ "github.com/lib/pq"
@@ -0,0 +1,7 @@
+//go:build sqlite
+// +build sqlite
+
+package imosql_test
+
+// The SQLite driver is linked only for make integration-test-sqlite.
+import _ "github.com/mattn/go-sqlite3"
@@ -12,7 +12,8 @@ import (
 
 var enableIntegrationTest = flag.Bool(
 	"enable_integration_test", false,
-	"Enables integration test using an actual MySQL server.")
+	"Enables integration test using an actual SQL server, which is MySQL "+
+		"unless --driver_name and --data_source_name are given.")
 
 var db *imosql.Connection = nil
 
@@ -165,3 +166,68 @@ func TestLogging(t *testing.T) {
 	imosql.SetLogging(true)
 	TestRows(t)
 }
+
+func TestRowsByKey(t *testing.T) {
+	openDatabase()
+	if db == nil {
+		return
+	}
+	rowsById := map[int]TestRow{}
+	db.RowsByKeyOrDie(&rowsById, "test_id", "SELECT * FROM test")
+	checkInterfaceEqual(
+		t,
+		`{"1": {"Id": 1, "String": "foo", "Int": 1, "Time": "2000-01-01T00:00:00Z"},
+		  "2": {"Id": 2, "String": "bar", "Int": 2, "Time": "2001-02-03T04:05:06Z"},
+		  "3": {"Id": 3, "String": "foobar", "Int": 3,
+		        "Time": "0001-01-01T00:00:00Z"}}`,
+		rowsById)
+	rowsByParity := map[int64][]TestRow{}
+	db.RowsByKeyOrDie(
+		&rowsByParity, "test_int",
+		"SELECT test_id, test_int % 2 AS test_int FROM test ORDER BY test_id")
+	checkInterfaceEqual(
+		t,
+		`{"0": [{"Id": 2, "String": "", "Int": 0, "Time": "0001-01-01T00:00:00Z"}],
+		  "1": [{"Id": 1, "String": "", "Int": 1, "Time": "0001-01-01T00:00:00Z"},
+		        {"Id": 3, "String": "", "Int": 1, "Time": "0001-01-01T00:00:00Z"}]}`,
+		rowsByParity)
+	if err := db.RowsByKey(
+		&rowsById, "test_int",
+		"SELECT test_id, test_int % 2 AS test_int FROM test"); err == nil {
+		t.Errorf("RowsByKey should fail for duplicate keys.")
+	}
+}
+
+func TestCurrentTime(t *testing.T) {
+	openDatabase()
+	if db == nil {
+		return
+	}
+	db.SetClockSyncInterval(time.Minute)
+	currentTime, err := db.Now()
+	if err != nil {
+		t.Fatalf("failed to get the current time: %s", err)
+	}
+	if gap := time.Since(currentTime); gap < -time.Hour || time.Hour < gap {
+		t.Errorf("the server time is too far from the local time: %v.", currentTime)
+	}
+	if !db.CurrentTime().After(currentTime.Add(-time.Second)) {
+		t.Errorf("the current time must not go back.")
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	openDatabase()
+	if db == nil {
+		return
+	}
+	db.SetClockSyncMode(imosql.ClockSyncRoundTrip, 3)
+	defer db.SetClockSyncMode(imosql.ClockSyncSingle, 0)
+	skew, err := db.ClockSkew()
+	if err != nil {
+		t.Fatalf("failed to estimate the clock skew: %s", err)
+	}
+	if skew.Uncertainty <= 0 || time.Second < skew.Uncertainty {
+		t.Errorf("unexpected uncertainty: %v.", skew.Uncertainty)
+	}
+}
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS test (
+  test_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  test_string VARCHAR(32) NOT NULL,
+  test_int INTEGER NOT NULL,
+  test_time DATETIME NOT NULL
+);
+
+INSERT INTO test (test_id, test_string, test_int, test_time) VALUES
+(1, 'foo', 1, '2000-01-01 00:00:00'),
+(2, 'bar', 2, '2001-02-03 04:05:06'),
+(3, 'foobar', 3, '0001-01-01 00:00:00');
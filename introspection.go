@@ -0,0 +1,251 @@
+package imosql
+
+// ColumnInfo describes a column of an existing table.
+type ColumnInfo struct {
+	Name string `sql:"column_name"`
+	// Type is the column type as the server shows it (e.g. "varchar(64)").
+	Type     string `sql:"column_type"`
+	Nullable bool   `sql:"is_nullable"`
+	// Default is the default value as the server shows it, or nil if the
+	// column has no default value.
+	Default *string `sql:"column_default"`
+	// Key is "PRI" for a primary key column, "UNI" for a unique column, "MUL"
+	// for an indexed column in MySQL or an empty string otherwise.
+	Key string `sql:"column_key"`
+	// Position starts from 1.
+	Position int `sql:"ordinal_position"`
+}
+
+// IndexInfo describes a column of an index.  An index with multiple columns
+// is represented by multiple IndexInfo sharing the same name.
+type IndexInfo struct {
+	Name   string `sql:"index_name"`
+	Column string `sql:"column_name"`
+	Unique bool   `sql:"is_unique"`
+	// Position is the position of the column in the index, which starts
+	// from 1.
+	Position int `sql:"seq_in_index"`
+}
+
+// ForeignKeyInfo describes a column of a foreign key.  A foreign key with
+// multiple columns is represented by multiple ForeignKeyInfo sharing the same
+// name.
+type ForeignKeyInfo struct {
+	Name             string `sql:"constraint_name"`
+	Column           string `sql:"column_name"`
+	ReferencedTable  string `sql:"referenced_table_name"`
+	ReferencedColumn string `sql:"referenced_column_name"`
+}
+
+// introspectionDialect is implemented by a Dialect supporting introspection.
+// Every query returns columns named after sql tags of the corresponding
+// struct, and every query but TablesQuery takes a table name as an argument.
+type introspectionDialect interface {
+	TablesQuery() string
+	ColumnsQuery() string
+	IndexesQuery() string
+	ForeignKeysQuery() string
+}
+
+func (c *Connection) introspectionDialect() (introspectionDialect, error) {
+	dialect, ok := c.Dialect().(introspectionDialect)
+	if !ok {
+		return nil, errorf("%s does not support introspection.", c.Dialect().Name())
+	}
+	return dialect, nil
+}
+
+// Tables returns the names of the tables in the current database (or the
+// current schema in PostgreSQL) in alphabetical order.
+func (c *Connection) Tables() ([]string, error) {
+	dialect, err := c.introspectionDialect()
+	if err != nil {
+		return nil, err
+	}
+	rows := []struct {
+		Name string `sql:"table_name"`
+	}{}
+	if err := c.Rows(&rows, dialect.TablesQuery()); err != nil {
+		return nil, err
+	}
+	tables := make([]string, len(rows))
+	for index, row := range rows {
+		tables[index] = row.Name
+	}
+	return tables, nil
+}
+
+// Columns returns the columns of a table in their order.
+func (c *Connection) Columns(table string) ([]ColumnInfo, error) {
+	dialect, err := c.introspectionDialect()
+	if err != nil {
+		return nil, err
+	}
+	columns := []ColumnInfo{}
+	if err := c.Rows(&columns, dialect.ColumnsQuery(), table); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, errorf("no such table: %s.", table)
+	}
+	return columns, nil
+}
+
+// Indexes returns the indexes of a table ordered by their names.
+func (c *Connection) Indexes(table string) ([]IndexInfo, error) {
+	dialect, err := c.introspectionDialect()
+	if err != nil {
+		return nil, err
+	}
+	indexes := []IndexInfo{}
+	err = c.Rows(&indexes, dialect.IndexesQuery(), table)
+	return indexes, err
+}
+
+// ForeignKeys returns the foreign keys of a table ordered by their names.
+func (c *Connection) ForeignKeys(table string) ([]ForeignKeyInfo, error) {
+	dialect, err := c.introspectionDialect()
+	if err != nil {
+		return nil, err
+	}
+	foreignKeys := []ForeignKeyInfo{}
+	err = c.Rows(&foreignKeys, dialect.ForeignKeysQuery(), table)
+	return foreignKeys, err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// MySQL
+////////////////////////////////////////////////////////////////////////////////
+
+// Column names are aliased because MySQL 8.0 returns them in upper case.
+
+func (MySQLDialect) TablesQuery() string {
+	return "SELECT table_name AS table_name FROM information_schema.tables " +
+		"WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE' " +
+		"ORDER BY table_name"
+}
+
+func (MySQLDialect) ColumnsQuery() string {
+	return "SELECT column_name AS column_name, column_type AS column_type, " +
+		"is_nullable = 'YES' AS is_nullable, column_default AS column_default, " +
+		"column_key AS column_key, ordinal_position AS ordinal_position " +
+		"FROM information_schema.columns " +
+		"WHERE table_schema = DATABASE() AND table_name = ? " +
+		"ORDER BY ordinal_position"
+}
+
+func (MySQLDialect) IndexesQuery() string {
+	return "SELECT index_name AS index_name, column_name AS column_name, " +
+		"non_unique = 0 AS is_unique, seq_in_index AS seq_in_index " +
+		"FROM information_schema.statistics " +
+		"WHERE table_schema = DATABASE() AND table_name = ? " +
+		"ORDER BY index_name, seq_in_index"
+}
+
+func (MySQLDialect) ForeignKeysQuery() string {
+	return "SELECT constraint_name AS constraint_name, " +
+		"column_name AS column_name, " +
+		"referenced_table_name AS referenced_table_name, " +
+		"referenced_column_name AS referenced_column_name " +
+		"FROM information_schema.key_column_usage " +
+		"WHERE table_schema = DATABASE() AND table_name = ? " +
+		"AND referenced_table_name IS NOT NULL " +
+		"ORDER BY constraint_name, ordinal_position"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PostgreSQL
+////////////////////////////////////////////////////////////////////////////////
+
+// Booleans are returned as integers because drivers give PostgreSQL booleans
+// as "true"/"false" or "t"/"f".
+
+func (PostgreSQLDialect) TablesQuery() string {
+	return "SELECT table_name FROM information_schema.tables " +
+		"WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' " +
+		"ORDER BY table_name"
+}
+
+func (PostgreSQLDialect) ColumnsQuery() string {
+	return "SELECT c.column_name, " +
+		"CASE WHEN c.character_maximum_length IS NOT NULL " +
+		"THEN c.data_type || '(' || c.character_maximum_length || ')' " +
+		"WHEN c.data_type = 'numeric' AND c.numeric_precision IS NOT NULL " +
+		"THEN 'numeric(' || c.numeric_precision || ',' || c.numeric_scale || ')' " +
+		"ELSE c.data_type END AS column_type, " +
+		"CASE WHEN c.is_nullable = 'YES' THEN 1 ELSE 0 END AS is_nullable, " +
+		"c.column_default, " +
+		"COALESCE((SELECT MIN(CASE tc.constraint_type " +
+		"WHEN 'PRIMARY KEY' THEN 'PRI' ELSE 'UNI' END) " +
+		"FROM information_schema.table_constraints tc " +
+		"JOIN information_schema.key_column_usage k " +
+		"ON k.constraint_name = tc.constraint_name " +
+		"AND k.table_schema = tc.table_schema " +
+		"WHERE tc.table_schema = c.table_schema " +
+		"AND tc.table_name = c.table_name AND k.column_name = c.column_name " +
+		"AND tc.constraint_type IN ('PRIMARY KEY', 'UNIQUE')), '') AS column_key, " +
+		"c.ordinal_position " +
+		"FROM information_schema.columns c " +
+		"WHERE c.table_schema = current_schema() AND c.table_name = ? " +
+		"ORDER BY c.ordinal_position"
+}
+
+func (PostgreSQLDialect) IndexesQuery() string {
+	return "SELECT i.relname AS index_name, a.attname AS column_name, " +
+		"CASE WHEN ix.indisunique THEN 1 ELSE 0 END AS is_unique, " +
+		"k.n AS seq_in_index " +
+		"FROM pg_class t JOIN pg_index ix ON t.oid = ix.indrelid " +
+		"JOIN pg_class i ON i.oid = ix.indexrelid " +
+		"CROSS JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, n) " +
+		"JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum " +
+		"WHERE t.relnamespace = current_schema()::regnamespace " +
+		"AND t.relname = ? ORDER BY i.relname, k.n"
+}
+
+func (PostgreSQLDialect) ForeignKeysQuery() string {
+	return "SELECT tc.constraint_name, k.column_name, " +
+		"u.table_name AS referenced_table_name, " +
+		"u.column_name AS referenced_column_name " +
+		"FROM information_schema.table_constraints tc " +
+		"JOIN information_schema.key_column_usage k " +
+		"ON k.constraint_name = tc.constraint_name " +
+		"AND k.table_schema = tc.table_schema " +
+		"JOIN information_schema.constraint_column_usage u " +
+		"ON u.constraint_name = tc.constraint_name " +
+		"AND u.table_schema = tc.table_schema " +
+		"WHERE tc.constraint_type = 'FOREIGN KEY' " +
+		"AND tc.table_schema = current_schema() AND tc.table_name = ? " +
+		"ORDER BY tc.constraint_name, k.ordinal_position"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SQLite
+////////////////////////////////////////////////////////////////////////////////
+
+// Queries for SQLite use table-valued pragma functions, which require SQLite
+// 3.16.0 or later.
+
+func (SQLiteDialect) TablesQuery() string {
+	return "SELECT name AS table_name FROM sqlite_master " +
+		"WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name"
+}
+
+func (SQLiteDialect) ColumnsQuery() string {
+	return "SELECT name AS column_name, type AS column_type, " +
+		"\"notnull\" = 0 AS is_nullable, dflt_value AS column_default, " +
+		"CASE WHEN pk > 0 THEN 'PRI' ELSE '' END AS column_key, " +
+		"cid + 1 AS ordinal_position FROM pragma_table_info(?) ORDER BY cid"
+}
+
+func (SQLiteDialect) IndexesQuery() string {
+	return "SELECT l.name AS index_name, i.name AS column_name, " +
+		"l.\"unique\" AS is_unique, i.seqno + 1 AS seq_in_index " +
+		"FROM pragma_index_list(?) AS l, pragma_index_info(l.name) AS i " +
+		"ORDER BY l.name, i.seqno"
+}
+
+func (SQLiteDialect) ForeignKeysQuery() string {
+	return "SELECT 'fk_' || id AS constraint_name, \"from\" AS column_name, " +
+		"\"table\" AS referenced_table_name, \"to\" AS referenced_column_name " +
+		"FROM pragma_foreign_key_list(?) ORDER BY id, seq"
+}
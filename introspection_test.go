@@ -0,0 +1,191 @@
+package imosql_test
+
+import (
+	imosql "."
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConnection_Introspection(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	dialect := imosql.MySQLDialect{}
+	fake.Expect(dialect.TablesQuery()).Returns(
+		[]string{"table_name"}, []interface{}{"posts"}, []interface{}{"users"})
+	fake.Expect(dialect.ColumnsQuery(), "users").Returns(
+		[]string{"column_name", "column_type", "is_nullable", "column_default",
+			"column_key", "ordinal_position"},
+		[]interface{}{"user_id", "bigint(20)", 0, nil, "PRI", 1},
+		[]interface{}{"user_name", "varchar(64)", 1, "", "UNI", 2})
+	fake.Expect(dialect.ColumnsQuery(), "missing").Returns(
+		[]string{"column_name", "column_type", "is_nullable", "column_default",
+			"column_key", "ordinal_position"})
+	fake.Expect(dialect.IndexesQuery(), "users").Returns(
+		[]string{"index_name", "column_name", "is_unique", "seq_in_index"},
+		[]interface{}{"PRIMARY", "user_id", 1, 1})
+	fake.Expect(dialect.ForeignKeysQuery(), "posts").Returns(
+		[]string{"constraint_name", "column_name", "referenced_table_name",
+			"referenced_column_name"},
+		[]interface{}{"posts_ibfk_1", "user_id", "users", "user_id"})
+	tables, err := con.Tables()
+	if err != nil {
+		t.Fatalf("failed to get tables: %s", err)
+	}
+	checkInterfaceEqual(t, `["posts", "users"]`, tables)
+	columns, err := con.Columns("users")
+	if err != nil {
+		t.Fatalf("failed to get columns: %s", err)
+	}
+	checkInterfaceEqual(
+		t,
+		`[{"Name": "user_id", "Type": "bigint(20)", "Nullable": false,
+		   "Default": null, "Key": "PRI", "Position": 1},
+		  {"Name": "user_name", "Type": "varchar(64)", "Nullable": true,
+		   "Default": "", "Key": "UNI", "Position": 2}]`,
+		columns)
+	if _, err := con.Columns("missing"); err == nil {
+		t.Errorf("Columns should fail for a missing table.")
+	}
+	indexes, err := con.Indexes("users")
+	if err != nil {
+		t.Fatalf("failed to get indexes: %s", err)
+	}
+	checkInterfaceEqual(
+		t,
+		`[{"Name": "PRIMARY", "Column": "user_id", "Unique": true, "Position": 1}]`,
+		indexes)
+	foreignKeys, err := con.ForeignKeys("posts")
+	if err != nil {
+		t.Fatalf("failed to get foreign keys: %s", err)
+	}
+	checkInterfaceEqual(
+		t,
+		`[{"Name": "posts_ibfk_1", "Column": "user_id",
+		   "ReferencedTable": "users", "ReferencedColumn": "user_id"}]`,
+		foreignKeys)
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnection_IntrospectionPostgreSQL(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	dialect := imosql.PostgreSQLDialect{}
+	con.SetDialect(dialect)
+	for _, query := range []string{dialect.ColumnsQuery(), dialect.IndexesQuery()} {
+		if strings.Contains(query, "AS is_") && !strings.Contains(query, "THEN 1 ELSE 0") {
+			t.Errorf("booleans should be returned as integers: %s", query)
+		}
+	}
+	fake.Expect(strings.Replace(dialect.ColumnsQuery(), "?", "$1", 1), "users").Returns(
+		[]string{"column_name", "column_type", "is_nullable", "column_default",
+			"column_key", "ordinal_position"},
+		[]interface{}{"user_id", "bigint", 0, nil, "PRI", 1},
+		[]interface{}{"user_name", "character varying(64)", 1, nil, "", 2})
+	fake.Expect(strings.Replace(dialect.IndexesQuery(), "?", "$1", 1), "users").Returns(
+		[]string{"index_name", "column_name", "is_unique", "seq_in_index"},
+		[]interface{}{"users_pkey", "user_id", 1, 1},
+		[]interface{}{"users_user_name_index", "user_name", 0, 1})
+	columns, err := con.Columns("users")
+	if err != nil {
+		t.Fatalf("failed to get columns: %s", err)
+	}
+	checkInterfaceEqual(
+		t,
+		`[{"Name": "user_id", "Type": "bigint", "Nullable": false,
+		   "Default": null, "Key": "PRI", "Position": 1},
+		  {"Name": "user_name", "Type": "character varying(64)", "Nullable": true,
+		   "Default": null, "Key": "", "Position": 2}]`,
+		columns)
+	indexes, err := con.Indexes("users")
+	if err != nil {
+		t.Fatalf("failed to get indexes: %s", err)
+	}
+	checkInterfaceEqual(
+		t,
+		`[{"Name": "users_pkey", "Column": "user_id", "Unique": true, "Position": 1},
+		  {"Name": "users_user_name_index", "Column": "user_name", "Unique": false,
+		   "Position": 1}]`,
+		indexes)
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+type VerifiedRow struct {
+	Id      int64     `sql:"user_id,pk"`
+	Name    string    `sql:"user_name"`
+	Age     int       `sql:"user_age"`
+	Created time.Time `sql:"user_created"`
+	Email   string    `sql:"user_email"`
+}
+
+func TestConnection_VerifySchema(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	columns := []string{"column_name", "column_type", "is_nullable",
+		"column_default", "column_key", "ordinal_position"}
+	rows := [][]interface{}{
+		[]interface{}{"user_id", "bigint(20)", 0, nil, "PRI", 1},
+		[]interface{}{"user_name", "varchar(64)", 0, nil, "", 2},
+		[]interface{}{"user_age", "int(11)", 1, nil, "", 3},
+		[]interface{}{"user_created", "varchar(32)", 0, nil, "", 4},
+		[]interface{}{"user_admin", "tinyint(1)", 0, nil, "", 5},
+	}
+	fake.Expect(imosql.MySQLDialect{}.ColumnsQuery(), "users").
+		Returns(columns, rows...)
+	fake.Expect(imosql.MySQLDialect{}.ColumnsQuery(), "users").
+		Returns(columns, rows[:2]...)
+	err := con.VerifySchema("users", VerifiedRow{})
+	schemaError, ok := err.(*imosql.SchemaError)
+	if !ok {
+		t.Fatalf("VerifySchema should return a SchemaError: %v", err)
+	}
+	checkInterfaceEqual(
+		t,
+		`["nullable column for a non-pointer field: user_age",
+		  "incompatible type: user_created is varchar(32) but time.Time",
+		  "missing column: user_email",
+		  "column without a field: user_admin"]`,
+		schemaError.Problems)
+	if err := con.VerifySchema("users", struct {
+		Id   uint64  `sql:"user_id"`
+		Name *string `sql:"user_name"`
+	}{}); err != nil {
+		t.Errorf("VerifySchema should succeed: %s", err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIsCompatibleColumnType(t *testing.T) {
+	int64Type := reflect.TypeOf(int64(0))
+	timeType := reflect.TypeOf(time.Time{})
+	testCases := []struct {
+		fieldType  reflect.Type
+		columnType string
+		expected   bool
+	}{
+		{int64Type, "bigint(20) unsigned", true},
+		{int64Type, "integer", true},
+		{int64Type, "decimal(20,0)", true},
+		{int64Type, "numeric(20)", true},
+		{int64Type, "decimal(10,2)", false},
+		{int64Type, "numeric", false},
+		{int64Type, "point", false},
+		{int64Type, "multipoint", false},
+		{int64Type, "linestring", false},
+		{int64Type, "interval", false},
+		{timeType, "date", true},
+		{timeType, "timestamp with time zone", true},
+		{timeType, "interval", false},
+	}
+	for _, testCase := range testCases {
+		actual := imosql.IsCompatibleColumnType(testCase.fieldType, testCase.columnType)
+		if actual != testCase.expected {
+			t.Errorf("%s for %s: expected: %v, actual: %v.", testCase.fieldType,
+				testCase.columnType, testCase.expected, actual)
+		}
+	}
+}
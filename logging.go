@@ -38,8 +38,31 @@ func printLogf(format string, a ...interface{}) {
 	return
 }
 
+// wrappedError is an error with a message describing its cause.
+type wrappedError struct {
+	message string
+	cause   error
+}
+
+func (e *wrappedError) Error() string {
+	return e.message
+}
+
+func (e *wrappedError) Unwrap() error {
+	return e.cause
+}
+
+// errorf returns an error with a formatted message.  If an argument is an
+// error, the returned error wraps it so that errors.Is and errors.As can see
+// the error of a driver.
 func errorf(format string, a ...interface{}) (err error) {
 	err = fmt.Errorf(format, a...)
+	for _, arg := range a {
+		if cause, ok := arg.(error); ok {
+			err = &wrappedError{message: err.Error(), cause: cause}
+			break
+		}
+	}
 	printLog(err)
 	return
 }
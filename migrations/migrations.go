@@ -0,0 +1,388 @@
+// Package migrations evolves a database schema with versioned migrations.
+// A migration is either a pair of SQL files in a directory or a pair of Go
+// functions:
+//
+//	migrations/0001_create_users.up.sql
+//	migrations/0001_create_users.down.sql
+//	migrations/0002_add_user_email.up.sql
+//	...
+//
+// Applied versions are recorded in the schema_migrations table.  Every
+// migration runs in its own transaction together with its record, and a
+// Migrator holds a server-side lock while it runs so that concurrent runners
+// (e.g. multiple servers starting at once) do not apply the same migration
+// twice.  Be careful that MySQL implicitly commits a transaction at a DDL
+// statement, so a failing migration with DDL statements may be left half
+// applied in MySQL.
+package migrations
+
+import (
+	"fmt"
+	"github.com/imos/imosql"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultTable is the default name of the table recording applied versions.
+const DefaultTable = "schema_migrations"
+
+// lockName is the name of the server-side lock held while migrating.
+const lockName = "imosql_migrations"
+
+// lockRetryInterval is the interval of trying to take the lock in PostgreSQL.
+var lockRetryInterval = 100 * time.Millisecond
+
+// Migration is a versioned change of a schema.
+type Migration struct {
+	// Version identifies the migration.  Migrations are applied in ascending
+	// order of their versions.
+	Version int64
+	Name    string
+	// Up applies the migration, and Down reverts it.  Down may be nil if the
+	// migration cannot be reverted.
+	Up   func(tx *imosql.Connection) error
+	Down func(tx *imosql.Connection) error
+	// upScript and downScript are the SQL files of Up and Down, which are
+	// nil unless the migration is added by Migrator.AddDirectory.
+	upScript   *script
+	downScript *script
+}
+
+// Status is the state of a migration.
+type Status struct {
+	Version int64
+	Name    string
+	// AppliedAt is the time when the migration was applied, or nil if the
+	// migration is pending.
+	AppliedAt *time.Time
+}
+
+// appliedMigration is a row of the table recording applied versions.
+type appliedMigration struct {
+	Version   int64     `sql:"version,pk"`
+	Name      string    `sql:"name,size=255"`
+	AppliedAt time.Time `sql:"applied_at"`
+}
+
+// Migrator applies and reverts migrations.
+type Migrator struct {
+	// Table is the name of the table recording applied versions.
+	Table string
+	// LockTimeout is the maximum time to wait for another runner.
+	LockTimeout time.Duration
+	migrations  map[int64]*Migration
+}
+
+// New creates a Migrator with no migrations.
+func New() *Migrator {
+	return &Migrator{
+		Table:       DefaultTable,
+		LockTimeout: time.Minute,
+		migrations:  map[int64]*Migration{},
+	}
+}
+
+// Register adds a migration.  It fails if the version is already registered.
+func (m *Migrator) Register(migration Migration) error {
+	if migration.Up == nil {
+		return fmt.Errorf("migration %d has no Up function.", migration.Version)
+	}
+	if _, ok := m.migrations[migration.Version]; ok {
+		return fmt.Errorf("migration %d is already registered.", migration.Version)
+	}
+	m.migrations[migration.Version] = &migration
+	return nil
+}
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(.*)\.(up|down)\.sql$`)
+
+// AddDirectory adds migrations in SQL files in a directory.  A file name
+// must be VERSION_NAME.up.sql or VERSION_NAME.down.sql, and other files are
+// ignored.  The up and down files of a version must have the same name.  A
+// file may have multiple statements separated by semicolons, which are split
+// in the syntax of the dialect of the Connection running them.  Migrator.Up
+// and Migrator.Down parse all the files to run before running any of them, so
+// a malformed file does not leave earlier migrations applied.
+func (m *Migrator) AddDirectory(directory string) error {
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return fmt.Errorf("failed to read a directory: %s", err)
+	}
+	scripts := map[int64]*Migration{}
+	for _, file := range files {
+		match := migrationFilePattern.FindStringSubmatch(file.Name())
+		if match == nil || file.IsDir() {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version: %s", file.Name())
+		}
+		input, err := ioutil.ReadFile(filepath.Join(directory, file.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read a migration: %s", err)
+		}
+		migration, ok := scripts[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			scripts[version] = migration
+		} else if migration.Name != match[2] {
+			return fmt.Errorf("migration %d has different names: %s and %s.",
+				version, migration.Name, match[2])
+		}
+		script := &script{name: file.Name(), text: string(input)}
+		if match[3] == "up" && migration.Up == nil {
+			migration.Up, migration.upScript = script.run, script
+		} else if match[3] == "down" && migration.Down == nil {
+			migration.Down, migration.downScript = script.run, script
+		} else {
+			return fmt.Errorf("migration %d has duplicate files: %s.", version, file.Name())
+		}
+	}
+	for _, migration := range scripts {
+		if err := m.Register(*migration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// script is a SQL file of a migration.
+type script struct {
+	name string
+	text string
+}
+
+func (s *script) statements(dialect imosql.Dialect) ([]string, error) {
+	statements, err := imosql.SplitStatements(dialect, s.text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", s.name, err)
+	}
+	return statements, nil
+}
+
+func (s *script) run(tx *imosql.Connection) error {
+	statements, err := s.statements(tx.Dialect())
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		if err := tx.Command(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkScripts parses the scripts of migrations, which are nil for migrations
+// registered as Go functions.
+func checkScripts(dialect imosql.Dialect, scripts []*script) error {
+	for _, script := range scripts {
+		if script == nil {
+			continue
+		}
+		if _, err := script.statements(dialect); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) sortedVersions() []int64 {
+	versions := []int64{}
+	for version := range m.migrations {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
+
+// appliedMigrations returns applied migrations by their versions, creating
+// the table recording them if necessary.
+func (m *Migrator) appliedMigrations(con *imosql.Connection) (map[int64]appliedMigration, error) {
+	if err := con.CreateTable(m.Table, appliedMigration{}); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", m.Table, err)
+	}
+	rows := map[int64]appliedMigration{}
+	if err := con.RowsByKey(&rows, "version", fmt.Sprintf(
+		"SELECT version, name, applied_at FROM %s",
+		con.Dialect().QuoteIdentifier(m.Table))); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", m.Table, err)
+	}
+	return rows, nil
+}
+
+// Status returns the states of registered migrations in ascending order of
+// their versions.  Migrations which are applied but not registered are also
+// returned.
+func (m *Migrator) Status(con *imosql.Connection) ([]Status, error) {
+	applied, err := m.appliedMigrations(con)
+	if err != nil {
+		return nil, err
+	}
+	result := []Status{}
+	for version, row := range applied {
+		if _, ok := m.migrations[version]; !ok {
+			appliedAt := row.AppliedAt
+			result = append(result, Status{version, row.Name, &appliedAt})
+		}
+	}
+	for _, version := range m.sortedVersions() {
+		status := Status{Version: version, Name: m.migrations[version].Name}
+		if row, ok := applied[version]; ok {
+			appliedAt := row.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result, nil
+}
+
+// Up applies all pending migrations in ascending order of their versions.
+func (m *Migrator) Up(con *imosql.Connection) error {
+	return m.withLock(con, func(session *imosql.Connection) error {
+		applied, err := m.appliedMigrations(session)
+		if err != nil {
+			return err
+		}
+		pending := []int64{}
+		scripts := []*script{}
+		for _, version := range m.sortedVersions() {
+			if _, ok := applied[version]; !ok {
+				pending = append(pending, version)
+				scripts = append(scripts, m.migrations[version].upScript)
+			}
+		}
+		if err := checkScripts(session.Dialect(), scripts); err != nil {
+			return err
+		}
+		for _, version := range pending {
+			migration := m.migrations[version]
+			err := session.Transaction(func(tx *imosql.Connection) error {
+				if err := migration.Up(tx); err != nil {
+					return err
+				}
+				appliedAt, err := tx.Now()
+				if err != nil {
+					return err
+				}
+				_, err = tx.Insert(m.Table, appliedMigration{
+					Version: version, Name: migration.Name, AppliedAt: appliedAt})
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf(
+					"failed to apply migration %d (%s): %w", version, migration.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts the last steps applied migrations in descending order of
+// their versions.  It reverts nothing if steps is zero, and it fails if steps
+// is negative.
+func (m *Migrator) Down(con *imosql.Connection, steps int) error {
+	if steps < 0 {
+		return fmt.Errorf("steps must not be negative: %d.", steps)
+	}
+	if steps == 0 {
+		return nil
+	}
+	return m.withLock(con, func(session *imosql.Connection) error {
+		applied, err := m.appliedMigrations(session)
+		if err != nil {
+			return err
+		}
+		versions := []int64{}
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+		if steps < len(versions) {
+			versions = versions[:steps]
+		}
+		scripts := []*script{}
+		for _, version := range versions {
+			migration, ok := m.migrations[version]
+			if !ok || migration.Down == nil {
+				return fmt.Errorf("migration %d cannot be reverted.", version)
+			}
+			scripts = append(scripts, migration.downScript)
+		}
+		if err := checkScripts(session.Dialect(), scripts); err != nil {
+			return err
+		}
+		for _, version := range versions {
+			migration := m.migrations[version]
+			err := session.Transaction(func(tx *imosql.Connection) error {
+				if err := migration.Down(tx); err != nil {
+					return err
+				}
+				return tx.Change(fmt.Sprintf(
+					"DELETE FROM %s WHERE version = ?",
+					tx.Dialect().QuoteIdentifier(m.Table)), version)
+			})
+			if err != nil {
+				return fmt.Errorf(
+					"failed to revert migration %d (%s): %w", version, migration.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// withLock runs f in a session holding the server-side lock for migrations.
+// SQLite does not need the lock because it serializes writers by itself.
+func (m *Migrator) withLock(con *imosql.Connection, f func(session *imosql.Connection) error) error {
+	session, err := con.Session()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	var unlockQuery string
+	switch session.Dialect().(type) {
+	case imosql.MySQLDialect:
+		// GET_LOCK waits for LockTimeout by itself, and returns 0 on timeout.
+		locked, err := session.Integer(fmt.Sprintf(
+			"SELECT GET_LOCK('%s', %d)", lockName, int64(m.LockTimeout/time.Second)))
+		if err != nil {
+			return fmt.Errorf("failed to lock migrations: %w", err)
+		}
+		if locked != 1 {
+			return fmt.Errorf("timed out waiting for another migration runner.")
+		}
+		unlockQuery = fmt.Sprintf("SELECT RELEASE_LOCK('%s')", lockName)
+	case imosql.PostgreSQLDialect:
+		// pg_advisory_lock waits forever, so pg_try_advisory_lock is polled
+		// until LockTimeout.
+		deadline := time.Now().Add(m.LockTimeout)
+		for {
+			locked, err := session.Integer(fmt.Sprintf(
+				"SELECT CASE WHEN pg_try_advisory_lock(hashtext('%s')) "+
+					"THEN 1 ELSE 0 END", lockName))
+			if err != nil {
+				return fmt.Errorf("failed to lock migrations: %w", err)
+			}
+			if locked == 1 {
+				break
+			}
+			if !time.Now().Before(deadline) {
+				return fmt.Errorf("timed out waiting for another migration runner.")
+			}
+			time.Sleep(lockRetryInterval)
+		}
+		unlockQuery = fmt.Sprintf("SELECT pg_advisory_unlock(hashtext('%s'))", lockName)
+	default:
+		return f(session)
+	}
+	defer session.Command(unlockQuery)
+	return f(session)
+}
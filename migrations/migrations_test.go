@@ -0,0 +1,170 @@
+package migrations_test
+
+import (
+	"github.com/imos/imosql"
+	"github.com/imos/imosql/imosqltest"
+	"github.com/imos/imosql/imosqltest/fakedb"
+	"github.com/imos/imosql/migrations"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const createTableQuery = "CREATE TABLE IF NOT EXISTS `schema_migrations` ( " +
+	"`version` BIGINT NOT NULL, `name` VARCHAR(255) NOT NULL, " +
+	"`applied_at` DATETIME NOT NULL, PRIMARY KEY (`version`) )"
+
+const selectQuery = "SELECT version, name, applied_at FROM `schema_migrations`"
+
+var appliedColumns = []string{"version", "name", "applied_at"}
+
+func openFakeDatabase(t *testing.T) (*imosql.Connection, *imosqltest.Database) {
+	con, fake := fakedb.Open(t)
+	con.SetClock(imosql.NewManualClock(
+		time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)))
+	return con, fake
+}
+
+func newMigrator(t *testing.T) *migrations.Migrator {
+	migrator := migrations.New()
+	if err := migrator.AddDirectory("testdata"); err != nil {
+		t.Fatalf("failed to add migrations: %s", err)
+	}
+	return migrator
+}
+
+func TestMigrator_Up(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	fake.Expect("SELECT GET_LOCK('imosql_migrations', 60)").
+		Returns([]string{"lock"}, []interface{}{1})
+	fake.Expect(createTableQuery)
+	fake.Expect(selectQuery).Returns(
+		appliedColumns, []interface{}{1, "create_users", "2000-01-01 00:00:00"})
+	fake.Expect(
+		"ALTER TABLE users ADD COLUMN user_email VARCHAR(255) /* nullable; */")
+	fake.Expect(
+		"INSERT INTO `schema_migrations` (`version`, `name`, `applied_at`) "+
+			"VALUES (?, ?, ?)",
+		2, "add_user_email", time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC))
+	fake.Expect("SELECT RELEASE_LOCK('imosql_migrations')")
+	if err := newMigrator(t).Up(con); err != nil {
+		t.Fatalf("failed to migrate: %s", err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMigrator_Down(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	fake.Expect("SELECT GET_LOCK('imosql_migrations', 60)").
+		Returns([]string{"lock"}, []interface{}{1})
+	fake.Expect(createTableQuery)
+	fake.Expect(selectQuery).Returns(
+		appliedColumns, []interface{}{1, "create_users", "2000-01-01 00:00:00"})
+	fake.Expect("DROP TABLE users")
+	fake.Expect("DELETE FROM `schema_migrations` WHERE version = ?", 1).
+		ReturnsResult(0, 1)
+	fake.Expect("SELECT RELEASE_LOCK('imosql_migrations')")
+	if err := newMigrator(t).Down(con, 1); err != nil {
+		t.Fatalf("failed to revert: %s", err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMigrator_Status(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	fake.Expect(createTableQuery)
+	fake.Expect(selectQuery).Returns(
+		appliedColumns, []interface{}{1, "create_users", "2000-01-01 00:00:00"})
+	statuses, err := newMigrator(t).Status(con)
+	if err != nil {
+		t.Fatalf("failed to get statuses: %s", err)
+	}
+	if len(statuses) != 2 ||
+		statuses[0].Version != 1 || statuses[0].AppliedAt == nil ||
+		statuses[1].Version != 2 || statuses[1].AppliedAt != nil {
+		t.Errorf("unexpected statuses: %#v.", statuses)
+	}
+}
+
+func TestMigrator_DownSteps(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	migrator := newMigrator(t)
+	if err := migrator.Down(con, -1); err == nil {
+		t.Errorf("Down should fail for negative steps.")
+	}
+	if err := migrator.Down(con, 0); err != nil {
+		t.Errorf("Down should revert nothing for zero steps: %s", err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMigrator_AddDirectoryDuplicates(t *testing.T) {
+	for _, files := range [][]string{
+		{"0001_a.up.sql", "0001_b.up.sql"},
+		{"0001_a.up.sql", "01_a.up.sql"},
+		{"0001_a.up.sql", "0001_b.down.sql"},
+	} {
+		directory := t.TempDir()
+		for _, file := range files {
+			if err := ioutil.WriteFile(
+				filepath.Join(directory, file), []byte("SELECT 1"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := migrations.New().AddDirectory(directory); err == nil {
+			t.Errorf("AddDirectory should fail for %v.", files)
+		}
+	}
+}
+
+func TestMigrator_UpMalformedScript(t *testing.T) {
+	directory := t.TempDir()
+	for file, script := range map[string]string{
+		"0001_a.up.sql": "CREATE TABLE a (id INT)",
+		"0002_b.up.sql": "INSERT INTO a VALUES ('1)",
+	} {
+		if err := ioutil.WriteFile(
+			filepath.Join(directory, file), []byte(script), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	migrator := migrations.New()
+	if err := migrator.AddDirectory(directory); err != nil {
+		t.Fatalf("failed to add migrations: %s", err)
+	}
+	con, fake := openFakeDatabase(t)
+	fake.Expect("SELECT GET_LOCK('imosql_migrations', 60)").
+		Returns([]string{"lock"}, []interface{}{1})
+	fake.Expect(createTableQuery)
+	fake.Expect(selectQuery).Returns(appliedColumns)
+	fake.Expect("SELECT RELEASE_LOCK('imosql_migrations')")
+	// No migrations are applied because 0002 is malformed.
+	if err := migrator.Up(con); err == nil {
+		t.Errorf("Up should fail for a malformed script.")
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMigrator_PostgreSQLLockTimeout(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	con.SetDialect(imosql.PostgreSQLDialect{})
+	fake.Expect("SELECT CASE WHEN pg_try_advisory_lock(hashtext('imosql_migrations')) "+
+		"THEN 1 ELSE 0 END").Returns([]string{"lock"}, []interface{}{0})
+	migrator := newMigrator(t)
+	migrator.LockTimeout = 0
+	if err := migrator.Up(con); err == nil {
+		t.Errorf("Up should time out if another runner holds the lock.")
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
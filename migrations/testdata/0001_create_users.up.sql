@@ -0,0 +1,3 @@
+-- Creates the users table.
+CREATE TABLE users (user_id INT PRIMARY KEY, user_name VARCHAR(64));
+INSERT INTO users VALUES (1, 'semicolon;');
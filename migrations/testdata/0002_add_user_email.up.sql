@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN user_email VARCHAR(255) /* nullable; */;
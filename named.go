@@ -0,0 +1,251 @@
+package imosql
+
+import (
+	"database/sql"
+	"reflect"
+	"time"
+)
+
+// parseNamedQuery replaces every :name placeholder in a query of dialect with
+// a positional placeholder and returns the rewritten query with the names in
+// the order they appear.
+func parseNamedQuery(dialect Dialect, query string) (result string, names []string, err error) {
+	result, err = rewritePlaceholders(dialect, query, func(name string) (string, error) {
+		if name == "" {
+			return "?", nil
+		}
+		names = append(names, name)
+		return "?", nil
+	})
+	return
+}
+
+// namedValues returns a function looking up a value by its name from arg,
+// which must be a map with string keys, a struct with sql tags or a pointer to
+// either of them.
+func namedValues(arg interface{}) (lookup func(string) (interface{}, bool), err error) {
+	value := reflect.ValueOf(arg)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			err = errorf("arg must not be a nil pointer.")
+			return
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			err = errorf(
+				"arg must be a map with string keys but a map with %s keys.",
+				value.Type().Key().String())
+			return
+		}
+		lookup = func(name string) (interface{}, bool) {
+			element := value.MapIndex(reflect.ValueOf(name).Convert(value.Type().Key()))
+			if !element.IsValid() {
+				return nil, false
+			}
+			return element.Interface(), true
+		}
+	case reflect.Struct:
+		if _, ok := value.Interface().(time.Time); ok {
+			err = errorf("arg must be a map or a struct but time.Time.")
+			return
+		}
+		nameToFieldIndex := map[string]int{}
+		for fieldIndex := 0; fieldIndex < value.NumField(); fieldIndex++ {
+			if name := ColumnName(value.Type().Field(fieldIndex)); name != "" {
+				nameToFieldIndex[name] = fieldIndex
+			}
+		}
+		lookup = func(name string) (interface{}, bool) {
+			fieldIndex, ok := nameToFieldIndex[name]
+			if !ok {
+				return nil, false
+			}
+			return value.Field(fieldIndex).Interface(), true
+		}
+	default:
+		err = errorf("arg must be a map or a struct but %s.", value.Kind().String())
+	}
+	return
+}
+
+// BindNamed converts a query with :name placeholders into a query with
+// positional placeholders and returns it with arguments in the corresponding
+// order.  arg must be a map with string keys (e.g. map[string]interface{}) or a
+// struct whose fields have sql tags.  A name may appear more than once, and
+// every name must be found in arg.  query is parsed in the syntax of MySQL, and
+// the functions of Connection (e.g. Connection.RowsNamed) parse queries in the
+// syntax of their dialects.
+func BindNamed(query string, arg interface{}) (boundQuery string, args []interface{}, err error) {
+	return bindNamed(MySQLDialect{}, query, arg)
+}
+
+func bindNamed(dialect Dialect, query string, arg interface{}) (boundQuery string, args []interface{}, err error) {
+	lookup, err := namedValues(arg)
+	if err != nil {
+		return
+	}
+	boundQuery, names, err := parseNamedQuery(dialect, query)
+	if err != nil {
+		return
+	}
+	args = make([]interface{}, len(names))
+	for index, name := range names {
+		value, ok := lookup(name)
+		if !ok {
+			err = errorf("no value for a named parameter: %s.", name)
+			return
+		}
+		args[index] = value
+	}
+	return
+}
+
+// ExecuteNamed runs Connection.Execute with :name placeholders bound from arg.
+// See BindNamed for details.
+func (c *Connection) ExecuteNamed(query string, arg interface{}) (sql.Result, error) {
+	boundQuery, args, err := bindNamed(c.Dialect(), query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return c.Execute(boundQuery, args...)
+}
+
+// ExecuteNamedOrDie runs Connection.ExecuteNamed.  If Connection.ExecuteNamed
+// fails, this function panics.
+func (c *Connection) ExecuteNamedOrDie(query string, arg interface{}) sql.Result {
+	result, err := c.ExecuteNamed(query, arg)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// CommandNamed runs Connection.Command with :name placeholders bound from arg.
+func (c *Connection) CommandNamed(query string, arg interface{}) error {
+	_, err := c.ExecuteNamed(query, arg)
+	return err
+}
+
+// CommandNamedOrDie runs Connection.CommandNamed.  If Connection.CommandNamed
+// fails, this function panics.
+func (c *Connection) CommandNamedOrDie(query string, arg interface{}) {
+	err := c.CommandNamed(query, arg)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ChangeNamed runs Connection.Change with :name placeholders bound from arg.
+func (c *Connection) ChangeNamed(query string, arg interface{}) error {
+	boundQuery, args, err := bindNamed(c.Dialect(), query, arg)
+	if err != nil {
+		return err
+	}
+	return c.Change(boundQuery, args...)
+}
+
+// ChangeNamedOrDie runs Connection.ChangeNamed.  If Connection.ChangeNamed
+// fails, this function panics.
+func (c *Connection) ChangeNamedOrDie(query string, arg interface{}) {
+	err := c.ChangeNamed(query, arg)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// StringNamed runs Connection.String with :name placeholders bound from arg.
+func (c *Connection) StringNamed(query string, arg interface{}) (result string, err error) {
+	boundQuery, args, err := bindNamed(c.Dialect(), query, arg)
+	if err != nil {
+		return
+	}
+	return c.String(boundQuery, args...)
+}
+
+// StringNamedOrDie runs Connection.StringNamed.  If Connection.StringNamed
+// fails, this function panics.
+func (c *Connection) StringNamedOrDie(query string, arg interface{}) string {
+	result, err := c.StringNamed(query, arg)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// IntegerNamed runs Connection.Integer with :name placeholders bound from arg.
+func (c *Connection) IntegerNamed(query string, arg interface{}) (result int64, err error) {
+	boundQuery, args, err := bindNamed(c.Dialect(), query, arg)
+	if err != nil {
+		return
+	}
+	return c.Integer(boundQuery, args...)
+}
+
+// IntegerNamedOrDie runs Connection.IntegerNamed.  If Connection.IntegerNamed
+// fails, this function panics.
+func (c *Connection) IntegerNamedOrDie(query string, arg interface{}) int64 {
+	result, err := c.IntegerNamed(query, arg)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// TimeNamed runs Connection.Time with :name placeholders bound from arg.
+func (c *Connection) TimeNamed(query string, arg interface{}) (result time.Time, err error) {
+	boundQuery, args, err := bindNamed(c.Dialect(), query, arg)
+	if err != nil {
+		return
+	}
+	return c.Time(boundQuery, args...)
+}
+
+// TimeNamedOrDie runs Connection.TimeNamed.  If Connection.TimeNamed fails,
+// this function panics.
+func (c *Connection) TimeNamedOrDie(query string, arg interface{}) time.Time {
+	result, err := c.TimeNamed(query, arg)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// RowsNamed runs Connection.Rows with :name placeholders bound from arg.
+func (c *Connection) RowsNamed(rowsPtr interface{}, query string, arg interface{}) error {
+	boundQuery, args, err := bindNamed(c.Dialect(), query, arg)
+	if err != nil {
+		return err
+	}
+	return c.Rows(rowsPtr, boundQuery, args...)
+}
+
+// RowsNamedOrDie runs Connection.RowsNamed.  If Connection.RowsNamed fails,
+// this function panics.
+func (c *Connection) RowsNamedOrDie(rowsPtr interface{}, query string, arg interface{}) {
+	err := c.RowsNamed(rowsPtr, query, arg)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RowNamed runs Connection.Row with :name placeholders bound from arg.
+func (c *Connection) RowNamed(rowPtr interface{}, query string, arg interface{}) (found bool, err error) {
+	boundQuery, args, err := bindNamed(c.Dialect(), query, arg)
+	if err != nil {
+		return
+	}
+	return c.Row(rowPtr, boundQuery, args...)
+}
+
+// RowNamedOrDie runs Connection.RowNamed.  If Connection.RowNamed fails, this
+// function panics.  It returns true iff there is at least one row.
+func (c *Connection) RowNamedOrDie(rowPtr interface{}, query string, arg interface{}) bool {
+	found, err := c.RowNamed(rowPtr, query, arg)
+	if err != nil {
+		panic(err)
+	}
+	return found
+}
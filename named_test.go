@@ -0,0 +1,105 @@
+package imosql_test
+
+import (
+	imosql "."
+	"reflect"
+	"testing"
+)
+
+func TestBindNamed(t *testing.T) {
+	type testCase struct {
+		query         string
+		expectedQuery string
+		expectedArgs  []interface{}
+	}
+	arg := map[string]interface{}{"id": 1, "name": "foo", "id2": 2}
+	testCases := []testCase{
+		testCase{
+			"SELECT * FROM test WHERE test_id = :id",
+			"SELECT * FROM test WHERE test_id = ?",
+			[]interface{}{1},
+		},
+		testCase{
+			"SELECT :id, :id2, :id, :name",
+			"SELECT ?, ?, ?, ?",
+			[]interface{}{1, 2, 1, "foo"},
+		},
+		testCase{
+			`SELECT ':id', ":id", ` + "`:id`" + `, 'it''s :id', 'a\':id', :name`,
+			`SELECT ':id', ":id", ` + "`:id`" + `, 'it''s :id', 'a\':id', ?`,
+			[]interface{}{"foo"},
+		},
+		testCase{
+			"SELECT :id -- :name\n, /* :name */ :id2 # :name",
+			"SELECT ? -- :name\n, /* :name */ ? # :name",
+			[]interface{}{1, 2},
+		},
+		testCase{
+			"SELECT :id::text, @a := :id2, TIME '12:00:00'",
+			"SELECT ?::text, @a := ?, TIME '12:00:00'",
+			[]interface{}{1, 2},
+		},
+	}
+	for _, c := range testCases {
+		query, args, err := imosql.BindNamed(c.query, arg)
+		if err != nil {
+			t.Errorf("failed to bind %#v: %s", c.query, err)
+			continue
+		}
+		if query != c.expectedQuery {
+			t.Errorf("expected: %#v, actual: %#v.", c.expectedQuery, query)
+		}
+		if !reflect.DeepEqual(args, c.expectedArgs) {
+			t.Errorf("expected: %#v, actual: %#v.", c.expectedArgs, args)
+		}
+	}
+}
+
+func TestBindNamed_Struct(t *testing.T) {
+	row := TestRow{Id: 2, String: "bar"}
+	query, args, err := imosql.BindNamed(
+		"UPDATE test SET test_string = :test_string WHERE test_id = :test_id", &row)
+	if err != nil {
+		t.Fatalf("failed to bind: %s", err)
+	}
+	if query != "UPDATE test SET test_string = ? WHERE test_id = ?" {
+		t.Errorf("unexpected query: %#v.", query)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"bar", 2}) {
+		t.Errorf("unexpected args: %#v.", args)
+	}
+}
+
+func TestBindNamed_Error(t *testing.T) {
+	arg := map[string]interface{}{"id": 1}
+	for _, query := range []string{
+		"SELECT :unknown",
+		"SELECT ':id",
+		"SELECT /* :id",
+	} {
+		if _, _, err := imosql.BindNamed(query, arg); err == nil {
+			t.Errorf("BindNamed should fail for %#v.", query)
+		}
+	}
+	if _, _, err := imosql.BindNamed("SELECT :id", 1); err == nil {
+		t.Errorf("BindNamed should fail for a non-map and non-struct arg.")
+	}
+}
+
+func TestConnection_NamedOrDie(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	fake.Expect("SELECT ? + ?", 1, 2).Returns([]string{"sum"}, []interface{}{3})
+	arg := map[string]interface{}{"a": 1, "b": 2}
+	if actual := con.IntegerNamedOrDie("SELECT :a + :b", arg); actual != 3 {
+		t.Errorf("unexpected result: %d.", actual)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("IntegerNamedOrDie should panic for an unknown name.")
+		}
+	}()
+	con.IntegerNamedOrDie("SELECT :unknown", arg)
+}
@@ -0,0 +1,185 @@
+package imosql
+
+import (
+	"strings"
+)
+
+// querySyntax is the lexical syntax of queries in a dialect, which decides
+// where string literals, quoted identifiers and comments are.
+type querySyntax struct {
+	// hashComments enables comments starting with # (MySQL).
+	hashComments bool
+	// backslashEscapes enables backslash escapes in every string literal and
+	// double-quoted string (MySQL).  Otherwise, only E'...' strings have
+	// backslash escapes (PostgreSQL).
+	backslashEscapes bool
+	// backquotes enables identifiers quoted with backquotes (MySQL and
+	// SQLite).
+	backquotes bool
+	// dollarQuotes enables dollar-quoted strings (e.g. $$...$$ and
+	// $tag$...$tag$ in PostgreSQL).
+	dollarQuotes bool
+}
+
+// syntaxOf returns the lexical syntax of a dialect.  Unknown dialects are
+// regarded as MySQL.
+func syntaxOf(dialect Dialect) querySyntax {
+	switch dialect.(type) {
+	case PostgreSQLDialect:
+		return querySyntax{dollarQuotes: true}
+	case SQLiteDialect:
+		return querySyntax{backquotes: true}
+	}
+	return querySyntax{hashComments: true, backslashEscapes: true, backquotes: true}
+}
+
+// literalEnd returns the index just after a string literal, a quoted
+// identifier or a comment starting at query[i], or i if none starts there.
+func (s querySyntax) literalEnd(query string, i int) (int, error) {
+	switch ch := query[i]; {
+	case ch == '\'' || ch == '"' || (ch == '`' && s.backquotes):
+		// E'...' is a string with backslash escapes in PostgreSQL.
+		escapes := s.backslashEscapes && ch != '`' ||
+			ch == '\'' && i > 0 && (query[i-1] == 'E' || query[i-1] == 'e') &&
+				(i == 1 || !isNamePart(query[i-2]))
+		end := i + 1
+		for ; end < len(query); end++ {
+			if query[end] == '\\' && escapes {
+				end++
+				continue
+			}
+			if query[end] == ch {
+				if end+1 < len(query) && query[end+1] == ch {
+					end++
+					continue
+				}
+				break
+			}
+		}
+		if end >= len(query) {
+			return 0, errorf("unterminated quotation at %d: %s", i, query)
+		}
+		return end + 1, nil
+	case ch == '#' && s.hashComments, strings.HasPrefix(query[i:], "--"):
+		end := strings.IndexByte(query[i:], '\n')
+		if end < 0 {
+			return len(query), nil
+		}
+		return i + end, nil
+	case strings.HasPrefix(query[i:], "/*"):
+		end := strings.Index(query[i+2:], "*/")
+		if end < 0 {
+			return 0, errorf("unterminated comment at %d: %s", i, query)
+		}
+		return i + 2 + end + 2, nil
+	case ch == '$' && s.dollarQuotes && (i == 0 || !isNamePart(query[i-1])):
+		tagEnd := i + 1
+		for tagEnd < len(query) && isNamePart(query[tagEnd]) &&
+			(tagEnd > i+1 || isNameStart(query[tagEnd])) {
+			tagEnd++
+		}
+		if tagEnd >= len(query) || query[tagEnd] != '$' {
+			return i, nil
+		}
+		tag := query[i : tagEnd+1]
+		end := strings.Index(query[tagEnd+1:], tag)
+		if end < 0 {
+			return 0, errorf("unterminated quotation at %d: %s", i, query)
+		}
+		return tagEnd + 1 + end + len(tag), nil
+	}
+	return i, nil
+}
+
+// rewritePlaceholders calls replace for every placeholder in query and returns
+// the query whose placeholders are replaced with the returned strings.  replace
+// receives an empty string for a positional placeholder (?) and a name for a
+// named placeholder (:name).  String literals, quoted identifiers, comments and
+// :: casts are left as they are, which are found by the syntax of dialect.
+func rewritePlaceholders(dialect Dialect, query string, replace func(name string) (string, error)) (string, error) {
+	syntax := syntaxOf(dialect)
+	output := make([]byte, 0, len(query))
+	for i := 0; i < len(query); i++ {
+		end, err := syntax.literalEnd(query, i)
+		if err != nil {
+			return "", err
+		}
+		if end > i {
+			output = append(output, query[i:end]...)
+			i = end - 1
+			continue
+		}
+		switch ch := query[i]; {
+		case ch == ':' && i+1 < len(query) && query[i+1] == ':':
+			output = append(output, "::"...)
+			i++
+		case ch == ':' && i+1 < len(query) && isNameStart(query[i+1]):
+			end := i + 1
+			for end < len(query) && isNamePart(query[end]) {
+				end++
+			}
+			replacement, err := replace(query[i+1 : end])
+			if err != nil {
+				return "", err
+			}
+			output = append(output, replacement...)
+			i = end - 1
+		case ch == '?':
+			replacement, err := replace("")
+			if err != nil {
+				return "", err
+			}
+			output = append(output, replacement...)
+		default:
+			output = append(output, ch)
+		}
+	}
+	return string(output), nil
+}
+
+// SplitStatements splits a SQL script into statements separated by semicolons
+// in the syntax of dialect.  Semicolons in string literals, quoted
+// identifiers and comments do not separate statements, and statements with
+// only comments are dropped.
+func SplitStatements(dialect Dialect, script string) ([]string, error) {
+	syntax := syntaxOf(dialect)
+	statements := []string{}
+	start := 0
+	hasCode := false
+	for i := 0; i < len(script); i++ {
+		end, err := syntax.literalEnd(script, i)
+		if err != nil {
+			return nil, err
+		}
+		if end > i {
+			if script[i] != '#' && !strings.HasPrefix(script[i:], "--") &&
+				!strings.HasPrefix(script[i:], "/*") {
+				hasCode = true
+			}
+			i = end - 1
+			continue
+		}
+		switch ch := script[i]; {
+		case ch == ';':
+			if hasCode {
+				statements = append(statements, strings.TrimSpace(script[start:i]))
+			}
+			start = i + 1
+			hasCode = false
+		case ch != ' ' && ch != '\t' && ch != '\r' && ch != '\n':
+			hasCode = true
+		}
+	}
+	if hasCode {
+		statements = append(statements, strings.TrimSpace(script[start:]))
+	}
+	return statements, nil
+}
+
+func isNameStart(ch byte) bool {
+	return ch == '_' || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z')
+}
+
+func isNamePart(ch byte) bool {
+	return isNameStart(ch) || ('0' <= ch && ch <= '9')
+}
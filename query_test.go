@@ -0,0 +1,46 @@
+package imosql_test
+
+import (
+	imosql "."
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	testCases := []struct {
+		dialect  imosql.Dialect
+		script   string
+		expected []string
+	}{
+		{
+			imosql.MySQLDialect{},
+			"CREATE TABLE t (a TEXT); -- a; b\n# c;\nINSERT INTO t VALUES ('\\';', \"`;\");" +
+				"/* d; */;\n\nSELECT `;`",
+			[]string{"CREATE TABLE t (a TEXT)",
+				"-- a; b\n# c;\nINSERT INTO t VALUES ('\\';', \"`;\")", "SELECT `;`"},
+		},
+		{
+			imosql.PostgreSQLDialect{},
+			"SELECT '\\'; SELECT E'\\';'; CREATE FUNCTION f() AS $body$ ; $body$;",
+			[]string{"SELECT '\\'", "SELECT E'\\';'", "CREATE FUNCTION f() AS $body$ ; $body$"},
+		},
+		{
+			imosql.SQLiteDialect{},
+			"SELECT 1 # 2; SELECT 3",
+			[]string{"SELECT 1 # 2", "SELECT 3"},
+		},
+	}
+	for _, c := range testCases {
+		actual, err := imosql.SplitStatements(c.dialect, c.script)
+		if err != nil {
+			t.Errorf("%s: failed to split %q: %s", c.dialect.Name(), c.script, err)
+		} else if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("%s: expected: %q, actual: %q.", c.dialect.Name(), c.expected, actual)
+		}
+	}
+	for _, script := range []string{"SELECT 'a", "SELECT 1 /* a"} {
+		if _, err := imosql.SplitStatements(imosql.MySQLDialect{}, script); err == nil {
+			t.Errorf("SplitStatements should fail for %q.", script)
+		}
+	}
+}
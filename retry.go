@@ -0,0 +1,122 @@
+package imosql
+
+import (
+	"database/sql"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy specifies how a Connection retries statements and transactions
+// failing with transient errors (e.g. deadlocks).  The n-th retry waits for
+// InitialBackoff * Multiplier^(n-1), which is capped by MaxBackoff and then
+// randomized by Jitter.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter is the ratio of randomization of a backoff.  For example, 0.2
+	// randomizes a backoff of 100ms within [80ms, 120ms].
+	Jitter float64
+	// IsRetryable classifies an error as retryable.  If it is nil, deadlocks,
+	// lock wait timeouts, serialization failures and broken connections are
+	// retryable.
+	IsRetryable func(err error) bool
+}
+
+// DefaultRetryPolicy is a RetryPolicy suitable for most applications.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 50 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+func (p *RetryPolicy) isRetryable(err error) bool {
+	if p.IsRetryable != nil {
+		return p.IsRetryable(err)
+	}
+	return isTransientError(err)
+}
+
+// Backoff returns the time to wait before the n-th retry, which starts from 1.
+func (p *RetryPolicy) Backoff(retry int) time.Duration {
+	backoff := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	backoff *= 1 + p.Jitter*(2*rand.Float64()-1)
+	return time.Duration(backoff)
+}
+
+// SetRetryPolicy makes the Connection retry statements and transactions
+// failing with retryable errors.  A nil policy disables retries, which is the
+// default.  Statements in a transaction are never retried by themselves
+// because a transaction is aborted by a deadlock, but Connection.Transaction
+// retries the whole transaction instead.
+//
+// Be careful that a statement or a transaction may be retried even if it has
+// been applied when a connection is broken after the server received it, so
+// that only idempotent statements should be retried if connection errors are
+// retryable.  Connection errors are never retried in a session because its
+// dedicated connection cannot recover.
+func (c *Connection) SetRetryPolicy(policy *RetryPolicy) {
+	c.retryPolicy = policy
+}
+
+// NoRetry returns a Connection running statements and transactions on c
+// without retries regardless of the retry policy of c.  Use it for ones which
+// cannot be run again (e.g. a transaction consuming an io.Reader).  Writes
+// through the returned Connection are recorded on c for read-your-writes
+// pinning.
+func (c *Connection) NoRetry() *Connection {
+	noRetry := c.Scope()
+	noRetry.retryPolicy = nil
+	noRetry.sharesWrites = true
+	return noRetry
+}
+
+// retry runs f until it succeeds or fails with a non-retryable error
+// following the retry policy of the Connection.
+func (c *Connection) retry(f func() error) error {
+	policy := c.retryPolicy
+	if policy == nil || c.tx != nil {
+		return f()
+	}
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= policy.MaxAttempts || !policy.isRetryable(err) ||
+			c.conn != nil && IsConnectionError(err) {
+			return err
+		}
+		backoff := policy.Backoff(attempt)
+		printLogf("retrying in %s after attempt #%d failed: %s", backoff, attempt, err)
+		time.Sleep(backoff)
+	}
+}
+
+// retryingQueryer retries statements following the retry policy of a
+// Connection.
+type retryingQueryer struct {
+	queryer    queryer
+	connection *Connection
+}
+
+func (rq retryingQueryer) Exec(query string, args ...interface{}) (result sql.Result, err error) {
+	err = rq.connection.retry(func() (err error) {
+		result, err = rq.queryer.Exec(query, args...)
+		return
+	})
+	return
+}
+
+func (rq retryingQueryer) Query(query string, args ...interface{}) (rows *sql.Rows, err error) {
+	err = rq.connection.retry(func() (err error) {
+		rows, err = rq.queryer.Query(query, args...)
+		return
+	})
+	return
+}
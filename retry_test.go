@@ -0,0 +1,126 @@
+package imosql_test
+
+import (
+	imosql "."
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeMySQLError has the same fields as MySQLError of
+// github.com/go-sql-driver/mysql.
+type fakeMySQLError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *fakeMySQLError) Error() string {
+	return e.Message
+}
+
+var deadlockError = &fakeMySQLError{1213, "Deadlock found when trying to get lock"}
+
+var testRetryPolicy = &imosql.RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	Multiplier:     2,
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := imosql.DefaultRetryPolicy
+	for retry, expected := range map[int]time.Duration{
+		1: 50 * time.Millisecond, 3: 200 * time.Millisecond, 10: 2 * time.Second} {
+		backoff := policy.Backoff(retry)
+		if backoff < expected*8/10 || expected*12/10 < backoff {
+			t.Errorf("retry #%d: expected: %s±20%%, actual: %s.", retry, expected, backoff)
+		}
+	}
+}
+
+func TestConnection_RetryStatement(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	con.SetRetryPolicy(testRetryPolicy)
+	fake.Expect("UPDATE test SET test_int = 1").ReturnsError(deadlockError)
+	fake.Expect("UPDATE test SET test_int = 1").ReturnsResult(0, 1)
+	fake.Expect("SELECT 1").ReturnsError(errors.New("syntax error"))
+	fake.Expect("SELECT 2").ReturnsError(deadlockError)
+	fake.Expect("SELECT 2").ReturnsError(deadlockError)
+	fake.Expect("SELECT 2").ReturnsError(deadlockError)
+	if err := con.Change("UPDATE test SET test_int = 1"); err != nil {
+		t.Errorf("a deadlock should be retried: %s", err)
+	}
+	if _, err := con.Integer("SELECT 1"); err == nil {
+		t.Errorf("a syntax error should not be retried.")
+	}
+	_, err := con.Integer("SELECT 2")
+	var mysqlError *fakeMySQLError
+	if !errors.As(err, &mysqlError) || mysqlError.Number != 1213 {
+		t.Errorf("the last error should be returned: %v", err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnection_RetryInSession(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	con.SetRetryPolicy(testRetryPolicy)
+	session, err := con.Session()
+	if err != nil {
+		t.Fatalf("failed to start a session: %s", err)
+	}
+	defer session.Close()
+	fake.Expect("SELECT 1").ReturnsError(&fakeMySQLError{2013, "Lost connection"})
+	fake.Expect("SELECT 2").ReturnsError(deadlockError)
+	fake.Expect("SELECT 2").Returns([]string{"2"}, []interface{}{2})
+	if _, err := session.Integer("SELECT 1"); !imosql.IsConnectionError(err) {
+		t.Errorf("a connection error in a session should not be retried: %v", err)
+	}
+	if _, err := session.Integer("SELECT 2"); err != nil {
+		t.Errorf("a deadlock in a session should be retried: %s", err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnection_NoRetry(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	con.SetRetryPolicy(testRetryPolicy)
+	fake.Expect("UPDATE test SET test_int = 1").ReturnsError(deadlockError)
+	fake.Expect("UPDATE test SET test_int = 2").ReturnsError(deadlockError)
+	if err := con.NoRetry().Change("UPDATE test SET test_int = 1"); !imosql.IsDeadlock(err) {
+		t.Errorf("a statement should not be retried: %v", err)
+	}
+	if err := con.NoRetry().Transaction(func(tx *imosql.Connection) error {
+		return tx.Change("UPDATE test SET test_int = 2")
+	}); !imosql.IsDeadlock(err) {
+		t.Errorf("a transaction should not be retried: %v", err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConnection_RetryTransaction(t *testing.T) {
+	con, fake := openFakeDatabase(t)
+	con.SetRetryPolicy(testRetryPolicy)
+	fake.Expect("UPDATE test SET test_int = 1")
+	fake.Expect("UPDATE test SET test_int = 2").ReturnsError(deadlockError)
+	fake.Expect("UPDATE test SET test_int = 1")
+	fake.Expect("UPDATE test SET test_int = 2")
+	attempts := 0
+	err := con.Transaction(func(tx *imosql.Connection) error {
+		attempts++
+		if err := tx.Command("UPDATE test SET test_int = 1"); err != nil {
+			return err
+		}
+		return tx.Command("UPDATE test SET test_int = 2")
+	})
+	if err != nil || attempts != 2 {
+		t.Errorf("unexpected result: %d attempts, %v.", attempts, err)
+	}
+	if err := fake.Check(); err != nil {
+		t.Error(err)
+	}
+}
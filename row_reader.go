@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,6 +14,14 @@ type RowReader struct {
 	columnNameToFieldIndex  map[string]int
 	columns                 []string
 	columnIndexToFieldIndex []int
+	dialect                 Dialect
+}
+
+// ColumnName returns the column name of a field of a row struct, which is
+// given by its sql tag.  Options following the name (e.g. `sql:"id,pk"`) are
+// ignored.
+func ColumnName(field reflect.StructField) string {
+	return strings.SplitN(field.Tag.Get("sql"), ",", 2)[0]
 }
 
 func NewRowReader(rowsPtr interface{}) (rowReader *RowReader, err error) {
@@ -38,17 +47,18 @@ func NewRowReader(rowsPtr interface{}) (rowReader *RowReader, err error) {
 	columnNameToFieldIndex := map[string]int{}
 	for fieldIndex := 0; fieldIndex < rowType.NumField(); fieldIndex++ {
 		field := rowType.Field(fieldIndex)
-		if field.Tag.Get("sql") == "" {
+		if ColumnName(field) == "" {
 			err = errorf(
 				"every field of a row struct must have a sql tag: %s", field.Name)
 			return
 		}
-		columnNameToFieldIndex[field.Tag.Get("sql")] = fieldIndex
+		columnNameToFieldIndex[ColumnName(field)] = fieldIndex
 	}
 	rowReader = &RowReader{
 		rowsPtr:                rowsPtr,
 		rowType:                rowType,
 		columnNameToFieldIndex: columnNameToFieldIndex,
+		dialect:                MySQLDialect{},
 	}
 	return
 }
@@ -72,7 +82,13 @@ func (rr *RowReader) SetColumns(columns []string) error {
 	return nil
 }
 
-func parseField(output reflect.Value, input string) error {
+// SetDialect sets a Dialect to parse time values.  RowReader uses
+// MySQLDialect by default.
+func (rr *RowReader) SetDialect(dialect Dialect) {
+	rr.dialect = dialect
+}
+
+func parseField(output reflect.Value, input string, dialect Dialect) error {
 	if output.Kind() == reflect.Ptr {
 		if output.IsNil() {
 			output.Set(reflect.New(output.Type().Elem()))
@@ -81,14 +97,7 @@ func parseField(output reflect.Value, input string) error {
 	}
 	switch output.Interface().(type) {
 	case time.Time:
-		if input == "0000-00-00 00:00:00" {
-			input = "0001-01-01 00:00:00"
-		}
-		location, err := time.LoadLocation("UTC")
-		if err != nil {
-			return err
-		}
-		result, err := time.ParseInLocation("2006-01-02 15:04:05", input, location)
+		result, err := dialect.ParseTime(input)
 		if err != nil {
 			return err
 		}
@@ -138,7 +147,7 @@ func (rr *RowReader) ParseFields(fields []sql.NullString) (row reflect.Value, er
 		}
 		if err = parseField(
 			row.Elem().Field(rr.columnIndexToFieldIndex[columnIndex]),
-			fieldValue.String); err != nil {
+			fieldValue.String, rr.dialect); err != nil {
 			return
 		}
 	}
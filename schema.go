@@ -0,0 +1,212 @@
+package imosql
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnSchema describes a column of a table, which is derived from a field
+// of a row struct.
+type ColumnSchema struct {
+	Name string
+	// Type is the type of the field, which is dereferenced if the field is a
+	// pointer.
+	Type reflect.Type
+	// Size is the maximum length of a string column.  Zero means unlimited.
+	Size          int
+	Nullable      bool
+	PrimaryKey    bool
+	AutoIncrement bool
+	Index         bool
+	Unique        bool
+	// Default is a SQL expression of the default value, or nil if the column
+	// has no default value.
+	Default *string
+}
+
+// TableSchema describes a table derived from a row struct.
+type TableSchema struct {
+	Name    string
+	Columns []ColumnSchema
+}
+
+// NewTableSchema creates a TableSchema from a row struct.  Every field must
+// have a sql tag with a column name optionally followed by comma-separated
+// options:
+//
+//	pk             The column is (a part of) the primary key.
+//	autoincrement  The column is filled by the server automatically.
+//	size=N         The column is a string of at most N characters.
+//	nullable       The column may be NULL.  Pointer fields are always nullable.
+//	index          The column has an index.
+//	unique         The column has a unique index.
+//	default=EXPR   The column has a default value given by a SQL expression.
+//	               This option must be the last because EXPR may have commas.
+//
+// For example, `sql:"user_name,size=64,unique"`.
+func NewTableSchema(table string, row interface{}) (*TableSchema, error) {
+	rowType := reflect.TypeOf(row)
+	for rowType != nil && rowType.Kind() == reflect.Ptr {
+		rowType = rowType.Elem()
+	}
+	if rowType == nil || rowType.Kind() != reflect.Struct {
+		return nil, errorf("row must be a struct but %T.", row)
+	}
+	schema := &TableSchema{Name: table}
+	for fieldIndex := 0; fieldIndex < rowType.NumField(); fieldIndex++ {
+		field := rowType.Field(fieldIndex)
+		column, err := parseColumnSchema(field)
+		if err != nil {
+			return nil, err
+		}
+		schema.Columns = append(schema.Columns, column)
+	}
+	if len(schema.Columns) == 0 {
+		return nil, errorf("row must have at least one field.")
+	}
+	return schema, nil
+}
+
+func parseColumnSchema(field reflect.StructField) (column ColumnSchema, err error) {
+	options := strings.Split(field.Tag.Get("sql"), ",")
+	column.Name = options[0]
+	if column.Name == "" {
+		err = errorf(
+			"every field of a row struct must have a sql tag: %s", field.Name)
+		return
+	}
+	column.Type = field.Type
+	if column.Type.Kind() == reflect.Ptr {
+		column.Type = column.Type.Elem()
+		column.Nullable = true
+	}
+	for optionIndex := 1; optionIndex < len(options); optionIndex++ {
+		option := strings.TrimSpace(options[optionIndex])
+		switch {
+		case option == "pk":
+			column.PrimaryKey = true
+		case option == "autoincrement":
+			column.AutoIncrement = true
+		case option == "nullable":
+			column.Nullable = true
+		case option == "index":
+			column.Index = true
+		case option == "unique":
+			column.Unique = true
+		case strings.HasPrefix(option, "size="):
+			column.Size, err = strconv.Atoi(strings.TrimPrefix(option, "size="))
+			if err != nil || column.Size <= 0 {
+				err = errorf("invalid size for %s: %s", column.Name, option)
+				return
+			}
+		case strings.HasPrefix(option, "default="):
+			defaultValue := strings.Join(options[optionIndex:], ",")
+			defaultValue = strings.TrimPrefix(strings.TrimSpace(defaultValue), "default=")
+			column.Default = &defaultValue
+			optionIndex = len(options)
+		default:
+			err = errorf("unknown option for %s: %s", column.Name, option)
+			return
+		}
+	}
+	if !isSupportedColumnType(column.Type) {
+		err = errorf("unsupported type for %s: %s", column.Name, column.Type.String())
+	}
+	return
+}
+
+// isSupportedColumnType returns true iff parseField supports t.
+func isSupportedColumnType(t reflect.Type) bool {
+	if t == reflect.TypeOf(time.Time{}) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// PrimaryKey returns the names of the primary key columns.
+func (ts *TableSchema) PrimaryKey() []string {
+	result := []string{}
+	for _, column := range ts.Columns {
+		if column.PrimaryKey {
+			result = append(result, column.Name)
+		}
+	}
+	return result
+}
+
+// columnDefinition returns a column definition in CREATE TABLE with a column
+// type given by a dialect.
+func columnDefinition(d Dialect, column ColumnSchema, columnType string) string {
+	definition := d.QuoteIdentifier(column.Name) + " " + columnType
+	if !column.Nullable {
+		definition += " NOT NULL"
+	}
+	if column.Default != nil {
+		definition += " DEFAULT " + *column.Default
+	}
+	return definition
+}
+
+// indexStatements returns CREATE INDEX statements for columns with the index
+// or unique option, which are shared by PostgreSQL and SQLite.
+func indexStatements(d Dialect, schema *TableSchema) []string {
+	statements := []string{}
+	for _, column := range schema.Columns {
+		if !column.Index && !column.Unique {
+			continue
+		}
+		statement := "CREATE INDEX IF NOT EXISTS "
+		if column.Unique {
+			statement = "CREATE UNIQUE INDEX IF NOT EXISTS "
+		}
+		statements = append(statements, fmt.Sprintf(
+			"%s%s ON %s (%s)", statement,
+			d.QuoteIdentifier(indexName(schema.Name, column)),
+			d.QuoteIdentifier(schema.Name), d.QuoteIdentifier(column.Name)))
+	}
+	return statements
+}
+
+func indexName(table string, column ColumnSchema) string {
+	if column.Unique {
+		return fmt.Sprintf("%s_%s_unique", table, column.Name)
+	}
+	return fmt.Sprintf("%s_%s_index", table, column.Name)
+}
+
+// CreateTable creates a table for a row struct if it does not exist.  See
+// NewTableSchema for options in sql tags.
+func (c *Connection) CreateTable(table string, row interface{}) error {
+	schema, err := NewTableSchema(table, row)
+	if err != nil {
+		return err
+	}
+	statements, err := c.Dialect().CreateTable(schema)
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		if err := c.Command(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateTableOrDie runs Connection.CreateTable.  If Connection.CreateTable
+// fails, this function panics.
+func (c *Connection) CreateTableOrDie(table string, row interface{}) {
+	err := c.CreateTable(table, row)
+	if err != nil {
+		panic(err)
+	}
+}
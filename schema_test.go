@@ -0,0 +1,92 @@
+package imosql_test
+
+import (
+	imosql "."
+	"reflect"
+	"testing"
+	"time"
+)
+
+type SchemaRow struct {
+	Id      int64     `sql:"user_id,pk,autoincrement"`
+	Name    string    `sql:"user_name,size=64,unique"`
+	Age     *uint8    `sql:"user_age"`
+	Admin   bool      `sql:"user_admin,default=0"`
+	Created time.Time `sql:"user_created,index,default='2000-01-01 00:00:00'"`
+}
+
+func TestDialect_CreateTable(t *testing.T) {
+	schema, err := imosql.NewTableSchema("users", SchemaRow{})
+	if err != nil {
+		t.Fatalf("failed to create a schema: %s", err)
+	}
+	testCases := map[imosql.Dialect][]string{
+		imosql.MySQLDialect{}: []string{
+			"CREATE TABLE IF NOT EXISTS `users` (\n" +
+				"  `user_id` BIGINT NOT NULL AUTO_INCREMENT,\n" +
+				"  `user_name` VARCHAR(64) NOT NULL,\n" +
+				"  `user_age` TINYINT UNSIGNED,\n" +
+				"  `user_admin` TINYINT(1) NOT NULL DEFAULT 0,\n" +
+				"  `user_created` DATETIME NOT NULL DEFAULT '2000-01-01 00:00:00',\n" +
+				"  PRIMARY KEY (`user_id`),\n" +
+				"  UNIQUE KEY `users_user_name_unique` (`user_name`),\n" +
+				"  KEY `users_user_created_index` (`user_created`)\n" +
+				")",
+		},
+		imosql.PostgreSQLDialect{}: []string{
+			"CREATE TABLE IF NOT EXISTS \"users\" (\n" +
+				"  \"user_id\" BIGSERIAL NOT NULL,\n" +
+				"  \"user_name\" VARCHAR(64) NOT NULL,\n" +
+				"  \"user_age\" SMALLINT,\n" +
+				"  \"user_admin\" BOOLEAN NOT NULL DEFAULT FALSE,\n" +
+				"  \"user_created\" TIMESTAMP NOT NULL DEFAULT '2000-01-01 00:00:00',\n" +
+				"  PRIMARY KEY (\"user_id\")\n" +
+				")",
+			`CREATE UNIQUE INDEX IF NOT EXISTS "users_user_name_unique" ` +
+				`ON "users" ("user_name")`,
+			`CREATE INDEX IF NOT EXISTS "users_user_created_index" ` +
+				`ON "users" ("user_created")`,
+		},
+		imosql.SQLiteDialect{}: []string{
+			"CREATE TABLE IF NOT EXISTS \"users\" (\n" +
+				"  \"user_id\" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,\n" +
+				"  \"user_name\" VARCHAR(64) NOT NULL,\n" +
+				"  \"user_age\" INTEGER,\n" +
+				"  \"user_admin\" INTEGER NOT NULL DEFAULT 0,\n" +
+				"  \"user_created\" DATETIME NOT NULL DEFAULT '2000-01-01 00:00:00'\n" +
+				")",
+			`CREATE UNIQUE INDEX IF NOT EXISTS "users_user_name_unique" ` +
+				`ON "users" ("user_name")`,
+			`CREATE INDEX IF NOT EXISTS "users_user_created_index" ` +
+				`ON "users" ("user_created")`,
+		},
+	}
+	for dialect, expected := range testCases {
+		actual, err := dialect.CreateTable(schema)
+		if err != nil {
+			t.Errorf("%s: failed to create a table: %s", dialect.Name(), err)
+			continue
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("%s: expected: %#v, actual: %#v.", dialect.Name(), expected, actual)
+		}
+	}
+}
+
+func TestNewTableSchema_Error(t *testing.T) {
+	type InvalidSize struct {
+		Name string `sql:"name,size=x"`
+	}
+	type UnknownOption struct {
+		Name string `sql:"name,primary"`
+	}
+	type UnsupportedType struct {
+		Value float64 `sql:"value"`
+	}
+	for _, row := range []interface{}{
+		InvalidSize{}, UnknownOption{}, UnsupportedType{}, 1} {
+		if _, err := imosql.NewTableSchema("test", row); err == nil {
+			t.Errorf("NewTableSchema should fail for %#v.", row)
+		}
+	}
+}
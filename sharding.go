@@ -0,0 +1,271 @@
+package imosql
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ShardFunc returns the index of the shard for a shard key, which must be in
+// [0, numShards).
+type ShardFunc func(key interface{}, numShards int) int
+
+// HashShard is a ShardFunc distributing keys by the FNV-1a hash of their
+// string representations.  Pointer keys are hashed by the values they point
+// to, and a nil pointer is hashed as nil.
+func HashShard(key interface{}, numShards int) int {
+	value := reflect.ValueOf(key)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			key = nil
+			break
+		}
+		value = value.Elem()
+		key = value.Interface()
+	}
+	hash := fnv.New32a()
+	fmt.Fprint(hash, key)
+	return int(hash.Sum32() % uint32(numShards))
+}
+
+// ShardedConnection routes queries to multiple Connections (e.g. MySQL
+// instances storing different users) by shard keys.
+type ShardedConnection struct {
+	shards    []*Connection
+	shardFunc ShardFunc
+}
+
+// NewShardedConnection creates a ShardedConnection with shards and a
+// ShardFunc.  HashShard is used if shardFunc is nil.
+func NewShardedConnection(shards []*Connection, shardFunc ShardFunc) (*ShardedConnection, error) {
+	if len(shards) == 0 {
+		return nil, errorf("there must be at least one shard.")
+	}
+	if shardFunc == nil {
+		shardFunc = HashShard
+	}
+	return &ShardedConnection{shards: shards, shardFunc: shardFunc}, nil
+}
+
+// Shards returns the Connections of the shards.
+func (s *ShardedConnection) Shards() []*Connection {
+	return s.shards
+}
+
+// Shard returns the Connection of the shard for a shard key, which runs any
+// queries on the shard:
+//
+//	shard, err := sharded.Shard(userId)
+//	if err != nil {
+//		return err
+//	}
+//	err = shard.Rows(&posts, "SELECT * FROM posts WHERE user_id = ?", userId)
+//
+// Shard fails if the ShardFunc returns an index out of range.
+func (s *ShardedConnection) Shard(key interface{}) (*Connection, error) {
+	index := s.shardFunc(key, len(s.shards))
+	if index < 0 || len(s.shards) <= index {
+		return nil, errorf(
+			"shard function returned %d for %d shards.", index, len(s.shards))
+	}
+	return s.shards[index], nil
+}
+
+// ShardOrDie runs ShardedConnection.Shard.  If ShardedConnection.Shard fails,
+// this function panics.
+func (s *ShardedConnection) ShardOrDie(key interface{}) *Connection {
+	shard, err := s.Shard(key)
+	if err != nil {
+		panic(err)
+	}
+	return shard
+}
+
+// GatherRows runs a query on all the shards concurrently, and fills rowsPtr
+// with their rows in the order of the shards.  rowsPtr must be a pointer to a
+// slice of a row struct as Connection.Rows requires, or a pointer to a slice
+// of pointers to a row struct.
+func (s *ShardedConnection) GatherRows(rowsPtr interface{}, query string, args ...interface{}) error {
+	rowsValue := reflect.ValueOf(rowsPtr)
+	if rowsValue.Kind() != reflect.Ptr || rowsValue.Elem().Kind() != reflect.Slice {
+		return errorf("rowsPtr must be a pointer to a slice but %T.", rowsPtr)
+	}
+	// Connection.Rows requires a slice of a struct, so rows for a slice of
+	// pointers are read into a slice of the struct first.
+	resultType := rowsValue.Elem().Type()
+	pointerRows := resultType.Elem().Kind() == reflect.Ptr
+	if pointerRows {
+		resultType = reflect.SliceOf(resultType.Elem().Elem())
+	}
+	results := make([]reflect.Value, len(s.shards))
+	shardErrors := make([]error, len(s.shards))
+	var waitGroup sync.WaitGroup
+	for shardIndex, shard := range s.shards {
+		waitGroup.Add(1)
+		go func(shardIndex int, shard *Connection) {
+			defer waitGroup.Done()
+			results[shardIndex] = reflect.New(resultType)
+			shardErrors[shardIndex] = shard.Rows(
+				results[shardIndex].Interface(), query, args...)
+		}(shardIndex, shard)
+	}
+	waitGroup.Wait()
+	rows := reflect.MakeSlice(rowsValue.Elem().Type(), 0, 0)
+	for shardIndex, result := range results {
+		if shardErrors[shardIndex] != nil {
+			return errorf("failed to query shard #%d: %s", shardIndex, shardErrors[shardIndex])
+		}
+		if !pointerRows {
+			rows = reflect.AppendSlice(rows, result.Elem())
+			continue
+		}
+		for index := 0; index < result.Elem().Len(); index++ {
+			rows = reflect.Append(rows, result.Elem().Index(index).Addr())
+		}
+	}
+	rowsValue.Elem().Set(rows)
+	return nil
+}
+
+// GatherRowsOrDie runs ShardedConnection.GatherRows.  If
+// ShardedConnection.GatherRows fails, this function panics.
+func (s *ShardedConnection) GatherRowsOrDie(rowsPtr interface{}, query string, args ...interface{}) {
+	err := s.GatherRows(rowsPtr, query, args...)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// GatherRowsOrderBy runs ShardedConnection.GatherRows and sorts the merged
+// rows by a column, which is given as "column" or "column DESC".  NULL
+// values come first in ascending order.  Rows with the same value keep the
+// order of the shards, so a query with the same ORDER BY gives the rows in
+// the order of the whole.  rowsPtr is the same as ShardedConnection.GatherRows
+// takes.
+func (s *ShardedConnection) GatherRowsOrderBy(rowsPtr interface{}, orderBy string, query string, args ...interface{}) error {
+	words := strings.Fields(orderBy)
+	if len(words) == 0 || len(words) > 2 ||
+		len(words) == 2 && !strings.EqualFold(words[1], "ASC") &&
+			!strings.EqualFold(words[1], "DESC") {
+		return errorf("invalid order: %s.", orderBy)
+	}
+	descending := len(words) == 2 && strings.EqualFold(words[1], "DESC")
+	rowsValue := reflect.ValueOf(rowsPtr)
+	if rowsValue.Kind() != reflect.Ptr || rowsValue.Elem().Kind() != reflect.Slice {
+		return errorf("rowsPtr must be a pointer to a slice of a struct but %T.", rowsPtr)
+	}
+	rowType := rowsValue.Elem().Type().Elem()
+	pointerRows := rowType.Kind() == reflect.Ptr
+	if pointerRows {
+		rowType = rowType.Elem()
+	}
+	if rowType.Kind() != reflect.Struct {
+		return errorf("rowsPtr must be a pointer to a slice of a struct but %T.", rowsPtr)
+	}
+	fieldIndex := -1
+	for index := 0; index < rowType.NumField(); index++ {
+		if ColumnName(rowType.Field(index)) == words[0] {
+			fieldIndex = index
+			break
+		}
+	}
+	if fieldIndex < 0 {
+		return errorf("no field has a sql tag for the order column: %s.", words[0])
+	}
+	if err := s.GatherRows(rowsPtr, query, args...); err != nil {
+		return err
+	}
+	rows := rowsValue.Elem()
+	field := func(index int) reflect.Value {
+		if pointerRows {
+			return rows.Index(index).Elem().Field(fieldIndex)
+		}
+		return rows.Index(index).Field(fieldIndex)
+	}
+	var compareErr error
+	sort.SliceStable(rows.Interface(), func(i, j int) bool {
+		result, err := compareFields(field(i), field(j))
+		if err != nil {
+			compareErr = err
+		}
+		if descending {
+			return result > 0
+		}
+		return result < 0
+	})
+	return compareErr
+}
+
+// GatherRowsOrderByOrDie runs ShardedConnection.GatherRowsOrderBy.  If
+// ShardedConnection.GatherRowsOrderBy fails, this function panics.
+func (s *ShardedConnection) GatherRowsOrderByOrDie(rowsPtr interface{}, orderBy string, query string, args ...interface{}) {
+	err := s.GatherRowsOrderBy(rowsPtr, orderBy, query, args...)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// compareFields returns a negative number, zero or a positive number if a is
+// less than, equal to or greater than b.  A nil pointer is less than any
+// other values.
+func compareFields(a, b reflect.Value) (int, error) {
+	if a.Kind() == reflect.Ptr {
+		switch {
+		case a.IsNil() && b.IsNil():
+			return 0, nil
+		case a.IsNil():
+			return -1, nil
+		case b.IsNil():
+			return 1, nil
+		}
+		a, b = a.Elem(), b.Elem()
+	}
+	if aTime, ok := a.Interface().(time.Time); ok {
+		bTime := b.Interface().(time.Time)
+		switch {
+		case aTime.Before(bTime):
+			return -1, nil
+		case aTime.After(bTime):
+			return 1, nil
+		}
+		return 0, nil
+	}
+	switch a.Kind() {
+	case reflect.Bool:
+		return compareInt64(boolToInt64(a.Bool()), boolToInt64(b.Bool())), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareInt64(a.Int(), b.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch {
+		case a.Uint() < b.Uint():
+			return -1, nil
+		case a.Uint() > b.Uint():
+			return 1, nil
+		}
+		return 0, nil
+	case reflect.String:
+		return strings.Compare(a.String(), b.String()), nil
+	}
+	return 0, errorf("unsupported type to order by: %s.", a.Type().String())
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolToInt64(value bool) int64 {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,187 @@
+package imosql_test
+
+import (
+	imosql "."
+	"github.com/imos/imosql/imosqltest"
+	"reflect"
+	"testing"
+)
+
+type shardedUser struct {
+	Id   int64   `sql:"user_id"`
+	Name *string `sql:"user_name"`
+}
+
+func openFakeShards(t *testing.T, numShards int) (*imosql.ShardedConnection, []*imosqltest.Database) {
+	shards := []*imosql.Connection{}
+	fakes := []*imosqltest.Database{}
+	for i := 0; i < numShards; i++ {
+		con, fake := openFakeDatabase(t)
+		shards = append(shards, con)
+		fakes = append(fakes, fake)
+	}
+	sharded, err := imosql.NewShardedConnection(
+		shards, func(key interface{}, numShards int) int {
+			return int(key.(int64) % int64(numShards))
+		})
+	if err != nil {
+		t.Fatalf("failed to create a sharded connection: %s", err)
+	}
+	return sharded, fakes
+}
+
+func TestShardedConnection_Shard(t *testing.T) {
+	sharded, fakes := openFakeShards(t, 2)
+	fakes[1].Expect("SELECT user_name FROM users WHERE user_id = ?", 3).
+		Returns([]string{"user_name"}, []interface{}{"foo"})
+	fakes[0].Expect("SELECT user_name FROM users WHERE user_id = ?", 4).
+		Returns([]string{"user_name"}, []interface{}{"bar"})
+	for _, c := range []struct {
+		id   int64
+		name string
+	}{{3, "foo"}, {4, "bar"}} {
+		name := sharded.ShardOrDie(c.id).StringOrDie(
+			"SELECT user_name FROM users WHERE user_id = ?", c.id)
+		if name != c.name {
+			t.Errorf("user %d should be %q, but %q.", c.id, c.name, name)
+		}
+	}
+	for _, fake := range fakes {
+		if err := fake.Check(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestShardedConnection_ShardOutOfRange(t *testing.T) {
+	con, _ := openFakeDatabase(t)
+	sharded, err := imosql.NewShardedConnection(
+		[]*imosql.Connection{con}, func(key interface{}, numShards int) int {
+			return numShards
+		})
+	if err != nil {
+		t.Fatalf("failed to create a sharded connection: %s", err)
+	}
+	if shard, err := sharded.Shard(1); shard != nil || err == nil {
+		t.Errorf("Shard should fail for an index out of range: %v, %v.", shard, err)
+	}
+}
+
+func TestHashShard_Pointer(t *testing.T) {
+	for key := int64(0); key < 100; key++ {
+		pointerKey := key
+		if imosql.HashShard(&pointerKey, 16) != imosql.HashShard(key, 16) {
+			t.Errorf("a pointer to %d should be hashed as %d.", key, key)
+		}
+	}
+	var nilKey *int64
+	if imosql.HashShard(nilKey, 16) != imosql.HashShard(nil, 16) {
+		t.Errorf("a nil pointer should be hashed as nil.")
+	}
+}
+
+func TestHashShard(t *testing.T) {
+	counts := make([]int, 4)
+	for key := 0; key < 1000; key++ {
+		shard := imosql.HashShard(key, len(counts))
+		if shard != imosql.HashShard(key, len(counts)) {
+			t.Fatalf("HashShard(%d) should be stable.", key)
+		}
+		counts[shard]++
+	}
+	for shard, count := range counts {
+		if count < 150 {
+			t.Errorf("shard #%d has too few keys: %d.", shard, count)
+		}
+	}
+}
+
+func TestShardedConnection_GatherRows(t *testing.T) {
+	sharded, fakes := openFakeShards(t, 3)
+	columns := []string{"user_id", "user_name"}
+	fakes[0].Expect("SELECT * FROM users").
+		Returns(columns, []interface{}{3, "c"}, []interface{}{6, nil})
+	fakes[1].Expect("SELECT * FROM users").
+		Returns(columns, []interface{}{1, "a"})
+	fakes[2].Expect("SELECT * FROM users").
+		Returns(columns, []interface{}{2, "b"}, []interface{}{5, "e"})
+	users := []shardedUser{}
+	sharded.GatherRowsOrDie(&users, "SELECT * FROM users")
+	ids := []int64{}
+	for _, user := range users {
+		ids = append(ids, user.Id)
+	}
+	if expected := []int64{3, 6, 1, 2, 5}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("ids should be %v, but %v.", expected, ids)
+	}
+	for _, fake := range fakes {
+		if err := fake.Check(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestShardedConnection_GatherRowsOrderBy(t *testing.T) {
+	columns := []string{"user_id", "user_name"}
+	for _, c := range []struct {
+		orderBy  string
+		expected []int64
+	}{
+		{"user_id", []int64{1, 2, 3, 5, 6}},
+		{"user_id DESC", []int64{6, 5, 3, 2, 1}},
+		{"user_name", []int64{6, 1, 2, 3, 5}},
+		{"user_name desc", []int64{5, 3, 2, 1, 6}},
+	} {
+		sharded, fakes := openFakeShards(t, 2)
+		fakes[0].Expect("SELECT * FROM users").
+			Returns(columns, []interface{}{3, "c"}, []interface{}{6, nil},
+				[]interface{}{1, "a"})
+		fakes[1].Expect("SELECT * FROM users").
+			Returns(columns, []interface{}{2, "b"}, []interface{}{5, "e"})
+		users := []shardedUser{}
+		sharded.GatherRowsOrderByOrDie(&users, c.orderBy, "SELECT * FROM users")
+		ids := []int64{}
+		for _, user := range users {
+			ids = append(ids, user.Id)
+		}
+		if !reflect.DeepEqual(ids, c.expected) {
+			t.Errorf("ids ordered by %s should be %v, but %v.", c.orderBy, c.expected, ids)
+		}
+	}
+}
+
+func TestShardedConnection_GatherRowsOrderByPointers(t *testing.T) {
+	sharded, fakes := openFakeShards(t, 2)
+	columns := []string{"user_id", "user_name"}
+	fakes[0].Expect("SELECT * FROM users").
+		Returns(columns, []interface{}{3, "c"}, []interface{}{1, "a"})
+	fakes[1].Expect("SELECT * FROM users").
+		Returns(columns, []interface{}{2, "b"})
+	users := []*shardedUser{}
+	sharded.GatherRowsOrderByOrDie(&users, "user_id", "SELECT * FROM users")
+	ids := []int64{}
+	for _, user := range users {
+		ids = append(ids, user.Id)
+	}
+	if !reflect.DeepEqual(ids, []int64{1, 2, 3}) {
+		t.Errorf("ids should be ordered, but %v.", ids)
+	}
+}
+
+func TestShardedConnection_GatherRowsError(t *testing.T) {
+	sharded, fakes := openFakeShards(t, 2)
+	fakes[0].Expect("SELECT * FROM users").
+		Returns([]string{"user_id", "user_name"}, []interface{}{1, "a"})
+	users := []shardedUser{}
+	if err := sharded.GatherRows(&users, "SELECT * FROM users"); err == nil {
+		t.Errorf("GatherRows should fail if a shard fails.")
+	}
+	if err := sharded.GatherRowsOrderBy(
+		&users, "no_such_column", "SELECT * FROM users"); err == nil {
+		t.Errorf("GatherRowsOrderBy should fail for an unknown column.")
+	}
+	if err := sharded.GatherRowsOrderBy(
+		&users, "user_id SIDEWAYS", "SELECT * FROM users"); err == nil {
+		t.Errorf("GatherRowsOrderBy should fail for an invalid order.")
+	}
+}
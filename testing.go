@@ -0,0 +1,83 @@
+package imosql
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// TestingT is the subset of testing.TB used by test helpers, so that ImoSQL
+// does not depend on the testing package.
+type TestingT interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+	Logf(format string, args ...interface{})
+	Cleanup(f func())
+}
+
+var testDatabaseCount int64 = 0
+
+// TestTransaction begins a transaction which is rolled back when the test
+// finishes, and returns a Connection running queries in it.  Tests using
+// different transactions can run in parallel as long as they do not lock the
+// same rows.  Since transactions cannot be nested, the code under test must
+// not begin another transaction.  Be careful that DDL statements implicitly
+// commit transactions in MySQL.
+func (c *Connection) TestTransaction(t TestingT) *Connection {
+	t.Helper()
+	tx, err := c.Begin()
+	if err != nil {
+		t.Fatalf("failed to begin a transaction for a test: %s", err)
+	}
+	t.Cleanup(func() {
+		if err := tx.Rollback(); err != nil {
+			t.Logf("failed to roll back a transaction for a test: %s", err)
+		}
+	})
+	return tx
+}
+
+// TestDatabase creates a uniquely named database which is dropped when the
+// test finishes, and returns a Connection whose current database is the
+// created one.  Unlike TestTransaction, the code under test can run DDL
+// statements and transactions.  This function requires MySQL.
+func (c *Connection) TestDatabase(t TestingT) *Connection {
+	t.Helper()
+	if _, ok := c.Dialect().(MySQLDialect); !ok {
+		t.Fatalf("TestDatabase does not support %s.", c.Dialect().Name())
+	}
+	session, err := c.Session()
+	if err != nil {
+		t.Fatalf("failed to start a session for a test: %s", err)
+	}
+	// DATABASE() returns NULL if no database is selected.
+	originalDatabase, err := session.String("SELECT IFNULL(DATABASE(), '')")
+	if err != nil {
+		session.Close()
+		t.Fatalf("failed to get the current database: %s", err)
+	}
+	database := session.Dialect().QuoteIdentifier(fmt.Sprintf(
+		"imosql_test_%d_%d", os.Getpid(), atomic.AddInt64(&testDatabaseCount, 1)))
+	if err := session.Command("CREATE DATABASE " + database); err != nil {
+		session.Close()
+		t.Fatalf("failed to create a database for a test: %s", err)
+	}
+	t.Cleanup(func() {
+		// Dropping the current database unselects it, so the original database
+		// must be selected again before the connection returns to the pool.
+		if err := session.Command("DROP DATABASE " + database); err != nil {
+			t.Logf("failed to drop a database for a test: %s", err)
+		}
+		if originalDatabase != "" {
+			if err := session.Command("USE " + session.Dialect().QuoteIdentifier(
+				originalDatabase)); err != nil {
+				t.Logf("failed to select the original database: %s", err)
+			}
+		}
+		session.Close()
+	})
+	if err := session.Command("USE " + database); err != nil {
+		t.Fatalf("failed to select a database for a test: %s", err)
+	}
+	return session
+}
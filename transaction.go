@@ -0,0 +1,188 @@
+package imosql
+
+import (
+	"context"
+	"database/sql"
+)
+
+// queryer is implemented by both sql.DB and sql.Tx.
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// connQueryer runs queries on a dedicated connection of a session.
+type connQueryer struct {
+	conn       *sql.Conn
+	connection *Connection
+}
+
+func (cq connQueryer) Exec(query string, args ...interface{}) (sql.Result, error) {
+	cq.connection.recordWrite()
+	return cq.conn.ExecContext(context.Background(), query, args...)
+}
+
+func (cq connQueryer) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return cq.conn.QueryContext(context.Background(), query, args...)
+}
+
+func (c *Connection) queryer() queryer {
+	if c.tx != nil {
+		return c.tx
+	}
+	var q queryer
+	if c.conn != nil {
+		q = connQueryer{conn: c.conn, connection: c}
+	} else {
+		q = routingQueryer{c}
+	}
+	if c.retryPolicy != nil {
+		return retryingQueryer{queryer: q, connection: c}
+	}
+	return q
+}
+
+// root returns the connection which is not in any transaction.  Connections
+// in transactions share states (e.g. clocks) with it.
+func (c *Connection) root() *Connection {
+	for c.parent != nil {
+		c = c.parent
+	}
+	return c
+}
+
+// Session returns a Connection running queries on a single dedicated
+// connection of the connection pool, so that session states (e.g. the
+// current database and session variables) are kept among queries.  The
+// returned Connection must be closed by Connection.Close.
+func (c *Connection) Session() (*Connection, error) {
+	if c.tx != nil || c.conn != nil {
+		return nil, errorf("a session or a transaction is already in progress.")
+	}
+	conn, err := c.sql.Conn(context.Background())
+	if err != nil {
+		return nil, errorf("failed to get a connection: %s", err)
+	}
+	return &Connection{
+		sql: c.sql, dialect: c.dialect, retryPolicy: c.retryPolicy,
+		conn: conn, parent: c}, nil
+}
+
+// Close returns the dedicated connection of a Connection returned by
+// Connection.Session to the connection pool.  If c is a Connection returned
+// by Open, Close stops replica health checks and closes the database and its
+// replicas, and its Connections (e.g. ones created by Connection.Scope)
+// cannot be used after that.
+func (c *Connection) Close() error {
+	if c.conn != nil {
+		if err := c.conn.Close(); err != nil {
+			return errorf("failed to close a session: %s", err)
+		}
+		return nil
+	}
+	if c.parent != nil {
+		return errorf("only a session or a connection returned by Open can be closed.")
+	}
+	err := c.replicas.close()
+	if sqlErr := c.sql.Close(); sqlErr != nil {
+		return errorf("failed to close the database: %s", sqlErr)
+	}
+	return err
+}
+
+// InSession returns true iff the connection runs queries on a dedicated
+// connection returned by Connection.Session.
+func (c *Connection) InSession() bool {
+	return c.conn != nil
+}
+
+// InTransaction returns true iff the connection runs queries in a
+// transaction.
+func (c *Connection) InTransaction() bool {
+	return c.tx != nil
+}
+
+// Begin starts a transaction and returns a Connection running queries in the
+// transaction.  The returned Connection must be finished by Connection.Commit
+// or Connection.Rollback.  Transactions cannot be nested.
+func (c *Connection) Begin() (*Connection, error) {
+	if c.tx != nil {
+		return nil, errorf("a transaction is already in progress.")
+	}
+	printLogf("beginning a transaction.")
+	var tx *sql.Tx
+	var err error
+	if c.conn != nil {
+		tx, err = c.conn.BeginTx(context.Background(), nil)
+	} else {
+		tx, err = c.sql.Begin()
+	}
+	if err != nil {
+		return nil, errorf("failed to begin a transaction: %s", err)
+	}
+	return &Connection{sql: c.sql, dialect: c.dialect, tx: tx, parent: c}, nil
+}
+
+// Commit commits the transaction of a Connection returned by
+// Connection.Begin.
+func (c *Connection) Commit() error {
+	if c.tx == nil {
+		return errorf("no transaction is in progress.")
+	}
+	printLogf("committing a transaction.")
+	if err := c.tx.Commit(); err != nil {
+		return errorf("failed to commit a transaction: %s", err)
+	}
+	c.recordWrite()
+	return nil
+}
+
+// Rollback aborts the transaction of a Connection returned by
+// Connection.Begin.
+func (c *Connection) Rollback() error {
+	if c.tx == nil {
+		return errorf("no transaction is in progress.")
+	}
+	printLogf("rolling back a transaction.")
+	if err := c.tx.Rollback(); err != nil {
+		return errorf("failed to roll back a transaction: %s", err)
+	}
+	return nil
+}
+
+// Transaction runs f in a transaction.  If f returns nil, the transaction is
+// committed, otherwise it is rolled back and the error is returned.  If f
+// panics, the transaction is rolled back and the panic continues.  If the
+// Connection has a retry policy (see Connection.SetRetryPolicy) and the
+// transaction fails with a retryable error, f is run again in a new
+// transaction, so f should not have side effects outside the transaction.
+func (c *Connection) Transaction(f func(tx *Connection) error) error {
+	return c.retry(func() error { return c.transaction(f) })
+}
+
+func (c *Connection) transaction(f func(tx *Connection) error) (err error) {
+	tx, err := c.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			tx.Rollback()
+			panic(recovered)
+		}
+	}()
+	if err = f(tx); err != nil {
+		tx.Rollback()
+		return
+	}
+	return tx.Commit()
+}
+
+// TransactionOrDie runs Connection.Transaction.  If Connection.Transaction
+// fails, this function panics.
+func (c *Connection) TransactionOrDie(f func(tx *Connection) error) {
+	err := c.Transaction(f)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,155 @@
+package imosql
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SchemaError reports differences between a row struct and a table.
+type SchemaError struct {
+	Table    string
+	Problems []string
+}
+
+func (e *SchemaError) Error() string {
+	return "schema of " + e.Table + " differs: " + strings.Join(e.Problems, "; ")
+}
+
+var columnTypeNamePattern = regexp.MustCompile(`^[a-z0-9 ]*[a-z0-9]`)
+
+// decimalScalePattern matches the precision and the scale of a DECIMAL or
+// NUMERIC column type.
+var decimalScalePattern = regexp.MustCompile(`^\(\s*\d+\s*(,\s*(\d+)\s*)?\)`)
+
+var integerTypeNames = map[string]bool{
+	"tinyint": true, "smallint": true, "mediumint": true, "int": true,
+	"integer": true, "bigint": true, "int2": true, "int4": true, "int8": true,
+	"serial": true, "smallserial": true, "bigserial": true,
+	"serial2": true, "serial4": true, "serial8": true,
+}
+
+// columnTypeClass classifies a column type shown by introspection into
+// "bool", "integer", "decimal" (with no fractional part), "time" or
+// "string".  Other types (e.g. FLOAT, BLOB and DECIMAL with a scale) are
+// classified as "other".
+func columnTypeClass(columnType string) string {
+	columnType = strings.ToLower(strings.TrimSpace(columnType))
+	if strings.HasPrefix(columnType, "tinyint(1)") &&
+		!strings.Contains(columnType, "unsigned") {
+		return "bool"
+	}
+	name := columnTypeNamePattern.FindString(columnType)
+	// Modifiers (e.g. UNSIGNED) follow the name.
+	if fields := strings.Fields(name); len(fields) > 0 && integerTypeNames[fields[0]] {
+		return "integer"
+	}
+	switch {
+	case name == "bool" || name == "boolean":
+		return "bool"
+	case name == "decimal" || name == "numeric":
+		// DECIMAL without a scale has a scale of zero, but PostgreSQL's
+		// NUMERIC without a precision has an arbitrary scale.
+		match := decimalScalePattern.FindStringSubmatch(
+			strings.TrimSpace(columnType[len(name):]))
+		if match != nil && (match[2] == "" || strings.Trim(match[2], "0") == "") {
+			return "decimal"
+		}
+		return "other"
+	case name == "date" || strings.HasPrefix(name, "datetime") ||
+		strings.HasPrefix(name, "timestamp"):
+		return "time"
+	case strings.Contains(name, "char") || strings.Contains(name, "text") ||
+		name == "enum" || name == "set" || name == "json" || name == "uuid":
+		return "string"
+	}
+	return "other"
+}
+
+// isCompatibleColumnType returns true iff parseField can parse every value of
+// a column of a class into a field of a type.  A string field accepts any
+// column.
+func isCompatibleColumnType(fieldType reflect.Type, class string) bool {
+	if fieldType == reflect.TypeOf(time.Time{}) {
+		return class == "time"
+	}
+	switch fieldType.Kind() {
+	case reflect.String:
+		return true
+	case reflect.Bool:
+		return class == "bool" || class == "integer"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		// PostgreSQLDialect stores unsigned 64-bit integers as NUMERIC(20),
+		// which is a decimal with a scale of zero.
+		return class == "bool" || class == "integer" || class == "decimal"
+	}
+	return false
+}
+
+// IsCompatibleColumnType returns true iff every value of a column of a type
+// shown by introspection (i.e. ColumnInfo.Type) can be read into a field of
+// fieldType, which Connection.VerifySchema checks for every field.  fieldType
+// must not be a pointer.
+func IsCompatibleColumnType(fieldType reflect.Type, columnType string) bool {
+	return isCompatibleColumnType(fieldType, columnTypeClass(columnType))
+}
+
+// VerifySchema compares the fields of a row struct with the columns of a
+// table, and returns a *SchemaError listing columns missing in the table,
+// columns without fields, nullable columns read into non-pointer fields and
+// columns whose types cannot be parsed into their fields.  See NewTableSchema
+// for sql tags of a row struct.
+func (c *Connection) VerifySchema(table string, row interface{}) error {
+	schema, err := NewTableSchema(table, row)
+	if err != nil {
+		return err
+	}
+	columns, err := c.Columns(table)
+	if err != nil {
+		return err
+	}
+	columnByName := map[string]ColumnInfo{}
+	for _, column := range columns {
+		columnByName[column.Name] = column
+	}
+	problems := []string{}
+	fields := map[string]bool{}
+	for _, field := range schema.Columns {
+		fields[field.Name] = true
+		column, ok := columnByName[field.Name]
+		if !ok {
+			problems = append(problems, "missing column: "+field.Name)
+			continue
+		}
+		if column.Nullable && !field.Nullable {
+			problems = append(problems,
+				"nullable column for a non-pointer field: "+field.Name)
+		}
+		if !IsCompatibleColumnType(field.Type, column.Type) {
+			problems = append(problems, "incompatible type: "+field.Name+
+				" is "+column.Type+" but "+field.Type.String())
+		}
+	}
+	for _, column := range columns {
+		if !fields[column.Name] {
+			problems = append(problems, "column without a field: "+column.Name)
+		}
+	}
+	if len(problems) > 0 {
+		err := &SchemaError{Table: table, Problems: problems}
+		printLog(err)
+		return err
+	}
+	return nil
+}
+
+// VerifySchemaOrDie runs Connection.VerifySchema.  If Connection.VerifySchema
+// fails, this function panics.
+func (c *Connection) VerifySchemaOrDie(table string, row interface{}) {
+	err := c.VerifySchema(table, row)
+	if err != nil {
+		panic(err)
+	}
+}